@@ -0,0 +1,187 @@
+package lockutil
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+)
+
+// Policy restricts lock requests for matching locks on a lockd node.
+type Policy struct {
+
+	// Namespace is the namespace pattern, empty for all namespaces.
+	Namespace string
+
+	// Pattern is the lock name pattern, * matches any sequence of characters and ? a single character.
+	Pattern string
+
+	// MaxTimeoutSeconds caps the wait timeout of lock requests, 0 for no cap.
+	MaxTimeoutSeconds int32
+
+	// Frozen rejects new lock requests, held locks can still be released.
+	Frozen bool
+}
+
+// DrainStatus describes a lockd node after draining or resuming it.
+type DrainStatus struct {
+
+	// Draining is true while the node rejects new lock requests.
+	Draining bool
+
+	// HeldLocks is the number of locks still held.
+	HeldLocks int
+
+	// Waiters is the number of requests waiting on the node.
+	Waiters int
+}
+
+// State is the state of a lockd node as returned by DumpState.
+type State struct {
+
+	// Locks are the locks of all namespaces with holders and waiters.
+	Locks []LockInfo
+
+	// Policies are the lock policies in the order they are matched.
+	Policies []Policy
+
+	// Draining is true while the node rejects new lock requests.
+	Draining bool
+}
+
+// ForceRelease releases the lock with the given name in the namespace of the client, regardless of who holds it.
+// The force token of the server is required. Servers without the AdminService are asked through ReleaseLock,
+// then the returned lock only carries name and namespace.
+func (c *Client) ForceRelease(ctx context.Context, forceToken, lockName string) ([]LockInfo, error) {
+	if forceToken == "" {
+		return nil, errors.New("force token is required")
+	}
+	resp, err := c.admin.ForceRelease(ctx, &pb.ForceReleaseRequest{ForceToken: forceToken, LockName: lockName, Namespace: c.namespace})
+	if status.Code(err) == codes.Unimplemented {
+		if err := c.ReleaseContext(ctx, lockName, forceToken, true); err != nil {
+			return nil, err
+		}
+		return []LockInfo{{Name: lockName, Namespace: types.Namespace(c.namespace)}}, nil
+	}
+	return released(resp, err)
+}
+
+// ForceReleasePattern releases all held locks whose name matches pattern in the namespace of the client or,
+// if allNamespaces is set, in all namespaces. Locks that could not be released are reported in the error,
+// the locks released are returned nevertheless. The force token of the server is required.
+func (c *Client) ForceReleasePattern(ctx context.Context, forceToken, pattern string, allNamespaces bool) ([]LockInfo, error) {
+	resp, err := c.admin.ForceRelease(ctx, &pb.ForceReleaseRequest{
+		ForceToken:    forceToken,
+		LockName:      pattern,
+		Pattern:       true,
+		Namespace:     c.namespace,
+		AllNamespaces: allNamespaces,
+	})
+	return released(resp, err)
+}
+
+// ReleaseOwner releases all locks held by addr, only those of pid unless pid is 0, in the namespace of the client
+// or, if allNamespaces is set, in all namespaces. addr is the owner address as returned by List. Locks that could
+// not be released are reported in the error. The force token of the server is required.
+func (c *Client) ReleaseOwner(ctx context.Context, forceToken, addr string, pid int32, allNamespaces bool) ([]LockInfo, error) {
+	resp, err := c.admin.ReleaseOwner(ctx, &pb.ReleaseOwnerRequest{
+		ForceToken:    forceToken,
+		Addr:          addr,
+		Pid:           pid,
+		Namespace:     c.namespace,
+		AllNamespaces: allNamespaces,
+	})
+	return released(resp, err)
+}
+
+// released converts the response of an administrative release, joining the reported failures into an error.
+func released(resp *pb.AdminReleaseResponse, err error) ([]LockInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, 0, len(resp.GetErrors()))
+	for _, msg := range resp.GetErrors() {
+		errs = append(errs, errors.New(msg))
+	}
+	return lockInfos(resp.GetReleased()), errors.Join(errs...)
+}
+
+// Drain makes the serving lockd node reject new lock requests with ErrShuttingDown and report NOT_SERVING to
+// health checks, e.g. before maintenance. Held locks and waiting requests are kept. The force token of the
+// server is required.
+func (c *Client) Drain(ctx context.Context, forceToken string) (DrainStatus, error) {
+	return c.drain(ctx, &pb.DrainRequest{ForceToken: forceToken})
+}
+
+// Resume makes the serving lockd node accept lock requests again after Drain. The force token of the server is
+// required.
+func (c *Client) Resume(ctx context.Context, forceToken string) (DrainStatus, error) {
+	return c.drain(ctx, &pb.DrainRequest{ForceToken: forceToken, Resume: true})
+}
+
+// drain sends a drain request.
+func (c *Client) drain(ctx context.Context, req *pb.DrainRequest) (DrainStatus, error) {
+	resp, err := c.admin.Drain(ctx, req)
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	return DrainStatus{Draining: resp.GetDraining(), HeldLocks: int(resp.GetHeldLocks()), Waiters: int(resp.GetWaiters())}, nil
+}
+
+// SetPolicy adds p to the policies of the serving lockd node, replacing a policy with the same namespace and
+// pattern. It returns all policies of the node. The force token of the server is required.
+func (c *Client) SetPolicy(ctx context.Context, forceToken string, p Policy) ([]Policy, error) {
+	return c.setPolicy(ctx, &pb.SetPolicyRequest{ForceToken: forceToken, Policy: lockPolicy(p)})
+}
+
+// RemovePolicy removes the policy with the given namespace and pattern from the serving lockd node. It returns
+// the remaining policies of the node. The force token of the server is required.
+func (c *Client) RemovePolicy(ctx context.Context, forceToken, namespace, pattern string) ([]Policy, error) {
+	return c.setPolicy(ctx, &pb.SetPolicyRequest{
+		ForceToken: forceToken,
+		Policy:     &pb.LockPolicy{Namespace: namespace, Pattern: pattern},
+		Remove:     true,
+	})
+}
+
+// setPolicy sends a policy change.
+func (c *Client) setPolicy(ctx context.Context, req *pb.SetPolicyRequest) ([]Policy, error) {
+	resp, err := c.admin.SetPolicy(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return policies(resp.GetPolicies()), nil
+}
+
+// DumpState returns locks, waiters, policies and the drain state of the serving lockd node. The force token of
+// the server is required.
+func (c *Client) DumpState(ctx context.Context, forceToken string) (*State, error) {
+	resp, err := c.admin.DumpState(ctx, &pb.DumpStateRequest{ForceToken: forceToken})
+	if err != nil {
+		return nil, err
+	}
+	return &State{Locks: lockInfos(resp.GetLocks()), Policies: policies(resp.GetPolicies()), Draining: resp.GetDraining()}, nil
+}
+
+// lockPolicy converts p for lockd.
+func lockPolicy(p Policy) *pb.LockPolicy {
+	return &pb.LockPolicy{Namespace: p.Namespace, Pattern: p.Pattern, MaxTimeoutSeconds: p.MaxTimeoutSeconds, Frozen: p.Frozen}
+}
+
+// policies converts the policies returned by lockd.
+func policies(list []*pb.LockPolicy) []Policy {
+	result := make([]Policy, 0, len(list))
+	for _, p := range list {
+		result = append(result, Policy{
+			Namespace:         p.GetNamespace(),
+			Pattern:           p.GetPattern(),
+			MaxTimeoutSeconds: p.GetMaxTimeoutSeconds(),
+			Frozen:            p.GetFrozen(),
+		})
+	}
+	return result
+}
@@ -2,14 +2,22 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sascha-andres/lockutil"
+	"github.com/sascha-andres/lockutil/internal/logging"
+	"github.com/sascha-andres/lockutil/internal/tracing"
 
 	"github.com/sascha-andres/reuse/flag"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
@@ -48,6 +56,33 @@ const (
 
 	// opForceRelease indicates an operation that forcibly releases resources or locks, without checking the current state.
 	opForceRelease
+
+	// opHistory represents an operation to list recorded events of a lock
+	opHistory
+
+	// opPing represents an operation checking that lockd is up and serving
+	opPing
+
+	// opWatch represents an operation printing lock events as they happen
+	opWatch
+
+	// opReleaseOwner represents an operation releasing all locks of an owner
+	opReleaseOwner
+
+	// opDrain represents an operation making lockd reject new lock requests
+	opDrain
+
+	// opResume represents an operation making lockd accept lock requests again
+	opResume
+
+	// opSetPolicy represents an operation adding, replacing or removing a lock policy
+	opSetPolicy
+
+	// opDump represents an operation printing locks, waiters, policies and drain state of lockd
+	opDump
+
+	// opStats represents an operation printing contention statistics per lock
+	opStats
 )
 
 var (
@@ -57,22 +92,82 @@ var (
 	forceToken string
 	help       bool
 	verbose    bool
+	logLevel   string
+	logFormat  string
 	timeout    int
+	addresses  string
+	since      time.Duration
+	until      time.Duration
+	useTLS     bool
+	tlsCA      string
+	tlsCert    string
+	tlsKey     string
+	token      string
+	namespace  string
+	allNS      bool
+	socket     string
+	prefix     string
+	pattern    bool
+	ownerAddr  string
+	ownerPid   int
+	maxTimeout int
+	frozen     bool
+	remove     bool
+	sortBy     string
+	top        int
 )
 
-// init initializes the logger settings, environment, and command-line flags for the application.
+// init initializes the environment and command-line flags for the application.
 func init() {
-	log.SetPrefix(fmt.Sprintf("[%s] ", strings.ToUpper(applicationName)))
-	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
-
 	flag.SetEnvPrefix(strings.ToUpper(applicationName))
 	flag.StringVar(&port, "port", defaultPort, "The port to connect to")
 	flag.StringVar(&host, "host", defaultHost, "The host to connect to")
 	flag.StringVar(&lockName, "lock", defaultLockJame, "The name of the lock to acquire")
 	flag.StringVar(&forceToken, "force-token", "", "The force token to use for force release")
+	flag.StringVar(&socket, "socket", "", "The Unix socket of lockd to connect to, overrides host and port")
+	flag.StringVar(&addresses, "addresses", "", "Comma separated host:port addresses of lockd cluster nodes, overrides host and port")
+	flag.BoolVar(&useTLS, "tls", false, "Connect using TLS, verifying the server against the system roots unless tls-ca is given")
+	flag.StringVar(&tlsCA, "tls-ca", "", "The PEM CA file to verify the server certificate with, enables TLS")
+	flag.StringVar(&tlsCert, "tls-cert", "", "The PEM client certificate file for mutual TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "The PEM key file of the client certificate")
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the lock, empty for the default namespace")
+	flag.BoolVar(&allNS, "all-namespaces", false, "List, watch or release locks of all namespaces")
+	flag.StringVar(&prefix, "prefix", "", "Watch all locks whose name starts with this prefix instead of the lock given by lock")
+	flag.StringVar(&token, "token", "", "The bearer token to authenticate with")
+	flag.BoolVar(&pattern, "pattern", false, "Treat lock as pattern with * and ? for force-release")
+	flag.StringVar(&ownerAddr, "owner-addr", "", "The owner address as shown by list whose locks release-owner releases")
+	flag.IntVar(&ownerPid, "owner-pid", 0, "Only release locks of this pid with release-owner, 0 for all")
+	flag.IntVar(&maxTimeout, "max-timeout", 0, "The maximum wait timeout in seconds set-policy allows for locks matching lock, 0 for no cap")
+	flag.BoolVar(&frozen, "frozen", false, "Make set-policy reject new lock requests for locks matching lock")
+	flag.BoolVar(&remove, "remove", false, "Make set-policy remove the policy for lock instead")
+	flag.StringVar(&sortBy, "sort", "acquisitions", "The column stats are sorted by: name, acquisitions, timeouts, cancels, queue, wait, wait-p99, hold or hold-p99")
+	flag.IntVar(&top, "top", 0, "Only show this number of locks with stats, 0 for all")
+	flag.DurationVar(&since, "since", 0, "Only show history events younger than this duration, 0 for all")
+	flag.DurationVar(&until, "until", 0, "Only show history events older than this duration, 0 for all")
 	flag.IntVar(&timeout, "timeout", defaultTimeout, "The timeout in seconds for the lock")
 	flag.BoolVar(&help, "help", false, "Prints this help message")
-	flag.BoolVar(&verbose, "verbose", false, "Enables verbose logging")
+	flag.BoolVar(&verbose, "verbose", false, "Enables verbose logging, same as log-level debug")
+	flag.StringVar(&logLevel, "log-level", "info", "The minimum level to log, one of debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", logging.FormatText, "The log format, text or json")
+}
+
+// setupLogging installs a logger writing to stderr in the configured format and level as default logger.
+func setupLogging() error {
+	l, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		l = slog.LevelDebug
+	}
+	level := new(slog.LevelVar)
+	level.Set(l)
+	logger, err := logging.New(os.Stderr, logFormat, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
 }
 
 // main is the entry point of the application which parses command-line flags and determines the operation to execute.
@@ -83,10 +178,12 @@ func main() {
 		flag.Usage()
 		return
 	}
-	ot := operationType(0)
-	if verbose {
-		log.Printf("Flags: %v", flag.GetVerbs())
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid logging configuration: %v\n", err)
+		os.Exit(1)
 	}
+	ot := operationType(0)
+	slog.Debug("parsed flags", "verbs", flag.GetVerbs())
 	if len(flag.GetVerbs()) == 0 {
 		ot = opAcquire
 	} else {
@@ -99,10 +196,38 @@ func main() {
 		if flag.GetVerbs()[0] == "force-release" {
 			ot = opForceRelease
 		}
+		if flag.GetVerbs()[0] == "history" {
+			ot = opHistory
+		}
+		if flag.GetVerbs()[0] == "ping" {
+			ot = opPing
+		}
+		if flag.GetVerbs()[0] == "watch" {
+			ot = opWatch
+		}
+		if flag.GetVerbs()[0] == "release-owner" {
+			ot = opReleaseOwner
+		}
+		if flag.GetVerbs()[0] == "drain" {
+			ot = opDrain
+		}
+		if flag.GetVerbs()[0] == "resume" {
+			ot = opResume
+		}
+		if flag.GetVerbs()[0] == "set-policy" {
+			ot = opSetPolicy
+		}
+		if flag.GetVerbs()[0] == "dump" {
+			ot = opDump
+		}
+		if flag.GetVerbs()[0] == "stats" {
+			ot = opStats
+		}
 	}
 
 	if err := run(ot); err != nil {
-		log.Fatalf("Failed to run: %v", err)
+		slog.Error("failed to run", "error", err)
+		os.Exit(1)
 	}
 }
 
@@ -110,11 +235,11 @@ func main() {
 // It either acquires or releases a lock by communicating with a gRPC LockServiceClient.
 func run(ot operationType) error {
 	if ot == opNone {
-		log.Println("Please specify no operation to lock or 'release' to release a lock")
+		slog.Error("please specify no operation to lock or 'release' to release a lock")
 		return errors.New("no supported operation")
 	}
 
-	if verbose {
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
 		otString := "ERR"
 		if ot == opRelease {
 			otString = "release"
@@ -128,14 +253,63 @@ func run(ot operationType) error {
 		if ot == opForceRelease {
 			otString = "force-release"
 		}
-		log.Printf("Running operation: %s", otString)
+		if ot == opHistory {
+			otString = "history"
+		}
+		if ot == opPing {
+			otString = "ping"
+		}
+		if ot == opWatch {
+			otString = "watch"
+		}
+		if ot == opReleaseOwner {
+			otString = "release-owner"
+		}
+		if ot == opDrain {
+			otString = "drain"
+		}
+		if ot == opResume {
+			otString = "resume"
+		}
+		if ot == opSetPolicy {
+			otString = "set-policy"
+		}
+		if ot == opDump {
+			otString = "dump"
+		}
+		if ot == opStats {
+			otString = "stats"
+		}
+		slog.Debug("running operation", "operation", otString)
 	}
 
-	l, err := lockutil.NewClient(lockutil.WithHost(host), lockutil.WithPort(port))
+	opts := []lockutil.ClientOption{lockutil.WithHost(host), lockutil.WithPort(port)}
+	if socket != "" {
+		opts = append(opts, lockutil.WithSocket(socket))
+	}
+	if addresses != "" {
+		opts = append(opts, lockutil.WithAddresses(strings.Split(addresses, ",")...))
+	}
+	if useTLS || tlsCA != "" {
+		opts = append(opts, lockutil.WithTLS(tlsCA))
+	}
+	if tlsCert != "" || tlsKey != "" {
+		opts = append(opts, lockutil.WithClientCertificate(tlsCert, tlsKey))
+	}
+	if token != "" {
+		opts = append(opts, lockutil.WithToken(token))
+	}
+	if namespace != "" {
+		opts = append(opts, lockutil.WithNamespace(namespace))
+	}
+	l, err := lockutil.NewClient(opts...)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		err = l.Close()
 		if err != nil {
-			log.Printf("failed to close connection: %v", err)
+			slog.Warn("failed to close connection", "error", err)
 		}
 	}()
 
@@ -143,51 +317,306 @@ func run(ot operationType) error {
 		return acquire(l)
 	}
 
-	if ot == opRelease || ot == opForceRelease {
-		return release(l, ot == opForceRelease)
+	if ot == opRelease {
+		return release(l)
+	}
+
+	if ot == opForceRelease {
+		return forceRelease(l)
+	}
+
+	if ot == opReleaseOwner {
+		return releaseOwner(l)
+	}
+
+	if ot == opDrain || ot == opResume {
+		return drain(l, ot == opResume)
+	}
+
+	if ot == opSetPolicy {
+		return setPolicy(l)
+	}
+
+	if ot == opDump {
+		return dump(l)
+	}
+
+	if ot == opStats {
+		return showStats(l)
 	}
 
 	if ot == opList {
 		return list(l)
 	}
 
+	if ot == opHistory {
+		return showHistory(l)
+	}
+
+	if ot == opPing {
+		return ping(l)
+	}
+
+	if ot == opWatch {
+		return watch(l)
+	}
+
 	return errors.New("no supported operation")
 }
 
 // list retrieves and prints a list of locks from the LockServiceClient.
 func list(l *lockutil.Client) error {
-	locks, err := l.List()
+	var (
+		locks []lockutil.LockInfo
+		err   error
+	)
+	if allNS {
+		locks, err = l.ListAllNamespaces()
+	} else {
+		locks, err = l.List()
+	}
 	if err != nil {
 		return err
 	}
 	for _, lock := range locks {
+		if allNS {
+			fmt.Printf("%s/", lock.Namespace)
+		}
 		fmt.Printf("%s: from pid %d on %s is locked: %t\n", lock.Name, lock.Pid, lock.Addr, lock.IsLocked)
 	}
 	return nil
 }
 
+// showHistory retrieves and prints the recorded events of the lock.
+func showHistory(l *lockutil.Client) error {
+	var from, to time.Time
+	if since > 0 {
+		from = time.Now().Add(-since)
+	}
+	if until > 0 {
+		to = time.Now().Add(-until)
+	}
+	events, err := l.History(lockName, from, to)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		printEvent(e)
+	}
+	return nil
+}
+
+// watch prints the events of the lock, or of all locks matching the prefix, as they happen until interrupted.
+func watch(l *lockutil.Client) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var (
+		events <-chan lockutil.HistoryEvent
+		err    error
+	)
+	switch {
+	case allNS:
+		events, err = l.WatchAllNamespaces(ctx, prefix)
+	case prefix != "":
+		events, err = l.WatchPrefix(ctx, prefix)
+	default:
+		events, err = l.Watch(ctx, lockName)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Debug("watching for lock events", "namespace", namespace, "lock", lockName, "prefix", prefix, "all_namespaces", allNS)
+	for e := range events {
+		printEvent(e)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("watch ended, lockd shut down or the connection was lost")
+}
+
+// printEvent prints a lock event on a single line.
+func printEvent(e lockutil.HistoryEvent) {
+	if allNS {
+		fmt.Printf("%s %s/%s: %s from pid %d on %s after %s\n", e.Time.Format(time.RFC3339), e.Namespace, e.Name, e.Type, e.Pid, e.Addr, e.Duration)
+		return
+	}
+	fmt.Printf("%s %s: %s from pid %d on %s after %s\n", e.Time.Format(time.RFC3339), e.Name, e.Type, e.Pid, e.Addr, e.Duration)
+}
+
 // release attempts to release a lock held by the current process using the provided LockServiceClient.
-func release(l *lockutil.Client, force bool) error {
-	if force && forceToken == "" {
+func release(l *lockutil.Client) error {
+	slog.Debug("releasing lock", "namespace", namespace, "lock", lockName)
+
+	err := l.ReleaseContext(traceContext(), lockName, "", false)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// forceRelease releases the lock, or with pattern all locks matching it, regardless of who holds it.
+func forceRelease(l *lockutil.Client) error {
+	if forceToken == "" {
 		return errors.New("force token is required")
 	}
-	if verbose {
-		log.Printf("Releasing lock: %s", lockName)
+	slog.Debug("force releasing lock", "namespace", namespace, "lock", lockName, "pattern", pattern, "all_namespaces", allNS)
+	var (
+		locks []lockutil.LockInfo
+		err   error
+	)
+	if pattern {
+		locks, err = l.ForceReleasePattern(traceContext(), forceToken, lockName, allNS)
+	} else {
+		locks, err = l.ForceRelease(traceContext(), forceToken, lockName)
 	}
+	printReleased(locks)
+	return err
+}
+
+// releaseOwner releases all locks held by the owner given by owner-addr and owner-pid.
+func releaseOwner(l *lockutil.Client) error {
+	if forceToken == "" {
+		return errors.New("force token is required")
+	}
+	if ownerAddr == "" {
+		return errors.New("owner-addr is required")
+	}
+	slog.Debug("releasing locks of owner", "namespace", namespace, "addr", ownerAddr, "pid", ownerPid, "all_namespaces", allNS)
+	locks, err := l.ReleaseOwner(traceContext(), forceToken, ownerAddr, int32(ownerPid), allNS)
+	printReleased(locks)
+	return err
+}
+
+// printReleased prints the locks released by an administrative release.
+func printReleased(locks []lockutil.LockInfo) {
+	for _, lock := range locks {
+		if lock.Addr == "" {
+			fmt.Printf("released %s/%s\n", lock.Namespace, lock.Name)
+			continue
+		}
+		fmt.Printf("released %s/%s: held by pid %d on %s\n", lock.Namespace, lock.Name, lock.Pid, lock.Addr)
+	}
+}
 
-	err := l.Release(lockName, forceToken, force)
+// drain makes lockd reject new lock requests or, with resume, accept them again.
+func drain(l *lockutil.Client, resume bool) error {
+	if forceToken == "" {
+		return errors.New("force token is required")
+	}
+	var (
+		st  lockutil.DrainStatus
+		err error
+	)
+	if resume {
+		st, err = l.Resume(context.Background(), forceToken)
+	} else {
+		st, err = l.Drain(context.Background(), forceToken)
+	}
 	if err != nil {
 		return err
 	}
+	fmt.Printf("%s draining: %t, held locks: %d, waiters: %d\n", l, st.Draining, st.HeldLocks, st.Waiters)
+	return nil
+}
+
+// setPolicy adds, replaces or removes the policy for locks matching lock in the namespace and prints all policies.
+func setPolicy(l *lockutil.Client) error {
+	if forceToken == "" {
+		return errors.New("force token is required")
+	}
+	var (
+		policies []lockutil.Policy
+		err      error
+	)
+	if remove {
+		policies, err = l.RemovePolicy(context.Background(), forceToken, namespace, lockName)
+	} else {
+		policies, err = l.SetPolicy(context.Background(), forceToken, lockutil.Policy{
+			Namespace:         namespace,
+			Pattern:           lockName,
+			MaxTimeoutSeconds: int32(maxTimeout),
+			Frozen:            frozen,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	printPolicies(policies)
+	return nil
+}
+
+// printPolicies prints the policies in the order they are matched.
+func printPolicies(policies []lockutil.Policy) {
+	for _, p := range policies {
+		ns := p.Namespace
+		if ns == "" {
+			ns = "*"
+		}
+		fmt.Printf("policy %s/%s: max timeout %ds, frozen: %t\n", ns, p.Pattern, p.MaxTimeoutSeconds, p.Frozen)
+	}
+}
+
+// dump prints locks with holders and waiters, policies and the drain state of lockd.
+func dump(l *lockutil.Client) error {
+	if forceToken == "" {
+		return errors.New("force token is required")
+	}
+	state, err := l.DumpState(context.Background(), forceToken)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s draining: %t\n", l, state.Draining)
+	for _, lock := range state.Locks {
+		fmt.Printf("%s/%s: from pid %d on %s is locked: %t", lock.Namespace, lock.Name, lock.Pid, lock.Addr, lock.IsLocked)
+		if !lock.Since.IsZero() {
+			fmt.Printf(" since %s", lock.Since.Format(time.RFC3339))
+		}
+		fmt.Println()
+		for _, w := range lock.Waiters {
+			fmt.Printf("  waiting: pid %d on %s since %s\n", w.Pid, w.Addr, w.Since.Format(time.RFC3339))
+		}
+	}
+	printPolicies(state.Policies)
 	return nil
 }
 
 // acquire attempts to obtain a lock by sending a request to the LockServiceClient.
 // It uses predefined lock parameters from getLockParameters() for lock name, timeout, and process ID.
 // If the lock is acquired successfully, the function will return nil. If not, an error or a failure message is printed.
+// Interrupting the process while waiting cancels the request.
 func acquire(l *lockutil.Client) error {
-	if verbose {
-		log.Printf("Acquiring lock: %s, timeout: %d", lockName, int32(timeout))
+	slog.Debug("acquiring lock", "namespace", namespace, "lock", lockName, "timeout", time.Duration(timeout)*time.Second)
+	ctx, stop := signal.NotifyContext(traceContext(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return l.AcquireContext(ctx, lockName, int32(timeout))
+}
+
+// traceContext returns a context carrying the trace context of the TRACEPARENT and TRACESTATE environment
+// variables, so lockd records its spans for the lock as part of the trace of the calling job.
+func traceContext() context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	return tracing.Propagator.Extract(context.Background(), carrier)
+}
+
+// ping checks that lockd is serving. With a timeout the check is repeated until lockd serves or the timeout elapsed.
+func ping(l *lockutil.Client) error {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := l.Ping(ctx)
+		cancel()
+		if err == nil {
+			fmt.Printf("%s is serving\n", l)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return err
+		}
+		slog.Debug("not serving yet", "server", l.String(), "error", err)
+		time.Sleep(500 * time.Millisecond)
 	}
-	return l.Acquire(lockName, int32(timeout))
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sascha-andres/lockutil"
+)
+
+// statsOrder compares two locks by a column of the stats table, largest first for all columns but name.
+var statsOrder = map[string]func(a, b lockutil.LockStats) int{
+	"name": func(a, b lockutil.LockStats) int {
+		return cmp.Or(strings.Compare(a.Namespace, b.Namespace), strings.Compare(a.Name, b.Name))
+	},
+	"acquisitions": func(a, b lockutil.LockStats) int { return cmp.Compare(b.Acquisitions, a.Acquisitions) },
+	"timeouts":     func(a, b lockutil.LockStats) int { return cmp.Compare(b.Timeouts, a.Timeouts) },
+	"cancels":      func(a, b lockutil.LockStats) int { return cmp.Compare(b.Cancels, a.Cancels) },
+	"queue":        func(a, b lockutil.LockStats) int { return cmp.Compare(b.MaxQueue, a.MaxQueue) },
+	"wait":         func(a, b lockutil.LockStats) int { return cmp.Compare(b.Wait.Avg, a.Wait.Avg) },
+	"wait-p99":     func(a, b lockutil.LockStats) int { return cmp.Compare(b.Wait.P99, a.Wait.P99) },
+	"hold":         func(a, b lockutil.LockStats) int { return cmp.Compare(b.Hold.Avg, a.Hold.Avg) },
+	"hold-p99":     func(a, b lockutil.LockStats) int { return cmp.Compare(b.Hold.P99, a.Hold.P99) },
+}
+
+// showStats prints the contention statistics per lock as a table sorted by the sort column, followed by the totals.
+func showStats(l *lockutil.Client) error {
+	order, ok := statsOrder[sortBy]
+	if !ok {
+		return fmt.Errorf("unknown sort column %q, expected name, acquisitions, timeouts, cancels, queue, wait, wait-p99, hold or hold-p99", sortBy)
+	}
+	var (
+		s   *lockutil.Stats
+		err error
+	)
+	if allNS {
+		s, err = l.StatsAllNamespaces(context.Background())
+	} else {
+		s, err = l.Stats(context.Background())
+	}
+	if err != nil {
+		return err
+	}
+	locks := s.Locks
+	slices.SortStableFunc(locks, order)
+	if top > 0 && len(locks) > top {
+		locks = locks[:top]
+	}
+	fmt.Printf("%s since %s\n", l, s.Since.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCK\tACQUIRED\tTIMEOUTS\tCANCELS\tFORCED\tMAX QUEUE\tWAIT AVG\tWAIT P50\tWAIT P99\tWAIT MAX\tHOLD AVG\tHOLD P99\tHOLD MAX")
+	for _, lock := range locks {
+		name := lock.Name
+		if allNS {
+			name = lock.Namespace + "/" + lock.Name
+		}
+		printStatsRow(w, name, lock)
+	}
+	printStatsRow(w, "TOTAL", s.Totals)
+	return w.Flush()
+}
+
+// printStatsRow writes the statistics of a lock as a row of the stats table.
+func printStatsRow(w *tabwriter.Writer, name string, s lockutil.LockStats) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, s.Acquisitions, s.Timeouts, s.Cancels,
+		s.ForcedReleases, s.MaxQueue, short(s.Wait.Avg), short(s.Wait.P50), short(s.Wait.P99), short(s.Wait.Max),
+		short(s.Hold.Avg), short(s.Hold.P99), short(s.Hold.Max))
+}
+
+// short rounds d for display, to milliseconds from one millisecond on and to microseconds below.
+func short(d time.Duration) string {
+	if d >= time.Millisecond {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/inmemory"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/sharded"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+	"github.com/sascha-andres/reuse/flag"
+)
+
+const (
+	applicationName = "lockbench"
+)
+
+var (
+	workers      int
+	names        int
+	shards       int
+	duration     time.Duration
+	listInterval time.Duration
+	help         bool
+)
+
+// init initializes the logger settings, environment, and command-line flags for the application.
+func init() {
+	log.SetPrefix(fmt.Sprintf("[%s] ", strings.ToUpper(applicationName)))
+	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+	flag.SetEnvPrefix(strings.ToUpper(applicationName))
+
+	flag.IntVar(&workers, "workers", 2000, "The number of concurrent acquirers")
+	flag.IntVar(&names, "names", 10000, "The number of distinct lock names")
+	flag.IntVar(&shards, "shards", sharded.DefaultShards, "The number of shards for the sharded backend")
+	flag.DurationVar(&duration, "duration", 5*time.Second, "How long to run each benchmark")
+	flag.DurationVar(&listInterval, "list-interval", 10*time.Millisecond, "How often to list all locks while benchmarking, 0 to disable")
+	flag.BoolVar(&help, "help", false, "Prints this help message")
+}
+
+// main compares the throughput of the lock backends for many concurrent acquirers across many lock names.
+func main() {
+	flag.Parse()
+	if help {
+		flag.Usage()
+		return
+	}
+
+	fmt.Printf("%d workers, %d lock names, %s per backend\n", workers, names, duration)
+	report("inmemory", bench(inmemory.NewInMemoryLocker()))
+	report(fmt.Sprintf("sharded(%d)", shards), bench(sharded.NewShardedLocker(shards)))
+}
+
+// result holds the counters of a single benchmark run.
+type result struct {
+	acquired int64
+	busy     int64
+	lists    int64
+	elapsed  time.Duration
+}
+
+// bench lets all workers acquire and release random locks on locker until the duration elapsed.
+func bench(locker types.Locker) result {
+	var (
+		r    result
+		wg   sync.WaitGroup
+		stop atomic.Bool
+	)
+	ctx := context.Background()
+	lockNames := make([]string, names)
+	for i := range lockNames {
+		lockNames[i] = fmt.Sprintf("lock-%d", i)
+	}
+
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(pid int32) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(pid)))
+			for !stop.Load() {
+				name := lockNames[rnd.Intn(len(lockNames))]
+				if err := locker.Lock(ctx, types.DefaultNamespace, name, pid, "bench"); err != nil {
+					atomic.AddInt64(&r.busy, 1)
+					continue
+				}
+				atomic.AddInt64(&r.acquired, 1)
+				_ = locker.Unlock(ctx, types.DefaultNamespace, name, pid, "bench")
+			}
+		}(int32(w))
+	}
+	if listInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				_ = locker.GetLocks(ctx)
+				atomic.AddInt64(&r.lists, 1)
+				time.Sleep(listInterval)
+			}
+		}()
+	}
+	time.Sleep(duration)
+	stop.Store(true)
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	return r
+}
+
+// report prints the throughput of a benchmark run.
+func report(name string, r result) {
+	seconds := r.elapsed.Seconds()
+	fmt.Printf("%-14s %12.0f acquire+release/s %12.0f busy/s %8d lists\n", name, float64(r.acquired)/seconds, float64(r.busy)/seconds, r.lists)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	stdflag "flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/auth"
+	"github.com/sascha-andres/lockutil/internal/config"
+	"github.com/sascha-andres/lockutil/internal/policy"
+	"github.com/sascha-andres/lockutil/server"
+	"github.com/sascha-andres/reuse/flag"
+)
+
+// commandLine holds the names of the flags given on the command line, they take precedence over the config file.
+var commandLine = make(map[string]bool)
+
+// configPolicies are the policies of the config file, applied on start and replaced on reload.
+var configPolicies []policy.Policy
+
+// reloading guards the flag values of reloadableKeys while lockd runs, they are changed by reload.
+var reloading sync.Mutex
+
+// setting is a flag value taken from the config file.
+type setting struct {
+	name  string
+	value string
+}
+
+// loadConfig reads the config file, if one is given, and applies it to all flags not given on the command line.
+func loadConfig() error {
+	flag.Visit(func(f *stdflag.Flag) {
+		commandLine[f.Name] = true
+	})
+	if configFile == "" {
+		return nil
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	return applyConfig(cfg, configKeys)
+}
+
+// applyConfig resets the flags named by keys that are not given on the command line to their defaults and sets
+// their values of cfg. The policies of cfg are kept in configPolicies.
+func applyConfig(cfg *config.Config, keys []string) error {
+	configPolicies = make([]policy.Policy, 0, len(cfg.Policies))
+	for _, p := range cfg.Policies {
+		configPolicies = append(configPolicies, p.Policy())
+	}
+	managed := make(map[string]bool, len(keys))
+	for _, name := range keys {
+		managed[name] = true
+	}
+	var err error
+	flag.VisitAll(func(f *stdflag.Flag) {
+		if managed[f.Name] && !commandLine[f.Name] && err == nil {
+			err = flag.Set(f.Name, f.DefValue)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range configSettings(cfg) {
+		if !managed[s.name] || commandLine[s.name] {
+			continue
+		}
+		if err := flag.Set(s.name, s.value); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// configKeys lists the flags that can be set using the config file.
+var configKeys = []string{
+	"verbose", "log-level", "log-format", "host", "port", "socket", "socket-mode", "socket-group", "backend", "shards", "history-size",
+	"state-file", "raft-id", "raft-peers", "raft-dir", "raft-secret", "token", "tls-cert", "tls-key", "tls-ca",
+	"tls-require-client-cert", "token-file", "acl-file", "secret-token", "secret-token-file",
+	"max-locks-per-client", "max-locks-per-namespace", "max-waiters-per-client", "max-waiters-per-namespace",
+	"shutdown-timeout", "metrics-listen", "http-listen", "dashboard", "trace-exporter", "trace-endpoint",
+	"trace-insecure", "trace-file", "audit-log", "audit-max-size", "audit-max-backups",
+	"reflection",
+}
+
+// reloadableKeys lists the flags applied again on reload, the other configKeys are only read on start.
+var reloadableKeys = []string{
+	"verbose", "log-level", "token-file", "acl-file", "secret-token", "secret-token-file",
+	"max-locks-per-client", "max-locks-per-namespace", "max-waiters-per-client", "max-waiters-per-namespace",
+	"shutdown-timeout",
+}
+
+// configSettings returns the flag values of all keys set in cfg.
+func configSettings(cfg *config.Config) []setting {
+	settings := make([]setting, 0)
+	str := func(name, value string) {
+		if value != "" {
+			settings = append(settings, setting{name: name, value: value})
+		}
+	}
+	num := func(name string, value int) {
+		if value != 0 {
+			settings = append(settings, setting{name: name, value: strconv.Itoa(value)})
+		}
+	}
+	boolean := func(name string, value bool) {
+		if value {
+			settings = append(settings, setting{name: name, value: "true"})
+		}
+	}
+
+	boolean("verbose", cfg.Verbose)
+	str("log-level", cfg.Log.Level)
+	str("log-format", cfg.Log.Format)
+	str("host", cfg.Listen.Host)
+	num("port", cfg.Listen.Port)
+	str("socket", cfg.Listen.Socket)
+	str("socket-mode", cfg.Listen.SocketMode)
+	str("socket-group", cfg.Listen.SocketGroup)
+	str("backend", cfg.Backend.Type)
+	num("shards", cfg.Backend.Shards)
+	num("history-size", cfg.Backend.HistorySize)
+	str("state-file", cfg.Backend.StateFile)
+	str("raft-id", cfg.Cluster.ID)
+	str("raft-peers", strings.Join(cfg.Cluster.Peers, ","))
+	str("raft-dir", cfg.Cluster.Dir)
+	str("token", cfg.Cluster.Token)
+	str("raft-secret", cfg.Cluster.Secret)
+	str("tls-cert", cfg.TLS.Cert)
+	str("tls-key", cfg.TLS.Key)
+	str("tls-ca", cfg.TLS.CA)
+	boolean("tls-require-client-cert", cfg.TLS.RequireClientCert)
+	str("token-file", cfg.Auth.TokenFile)
+	str("acl-file", cfg.Auth.ACLFile)
+	str("secret-token", cfg.Auth.ForceToken)
+	str("secret-token-file", cfg.Auth.ForceTokenFile)
+	num("max-locks-per-client", cfg.Limits.MaxLocksPerClient)
+	num("max-locks-per-namespace", cfg.Limits.MaxLocksPerNamespace)
+	num("max-waiters-per-client", cfg.Limits.MaxWaitersPerClient)
+	num("max-waiters-per-namespace", cfg.Limits.MaxWaitersPerNamespace)
+	str("shutdown-timeout", cfg.ShutdownTimeout)
+	str("metrics-listen", cfg.Metrics.Listen)
+	str("http-listen", cfg.HTTP.Listen)
+	boolean("dashboard", cfg.HTTP.Dashboard)
+	str("trace-exporter", cfg.Tracing.Exporter)
+	str("trace-endpoint", cfg.Tracing.Endpoint)
+	boolean("trace-insecure", cfg.Tracing.Insecure)
+	str("trace-file", cfg.Tracing.File)
+	str("audit-log", cfg.Audit.File)
+	num("audit-max-size", cfg.Audit.MaxSizeMB)
+	num("audit-max-backups", cfg.Audit.MaxBackups)
+	boolean("reflection", cfg.Reflection)
+	return settings
+}
+
+// reloader applies the reloadable parts of the configuration to a running lockd: the log level, force tokens,
+// bearer tokens, ACL rules, limits, policies and the shutdown timeout. The log format, listeners, backend, cluster
+// and TLS settings require a restart.
+type reloader struct {
+	forceTokens   *auth.ForceTokens
+	authenticator *server.Authenticator
+	acl           *auth.ACL
+	lockServer    *server.LockServer
+	policies      *policy.Set
+
+	// applied are the policies of the config file currently applied to policies.
+	applied []policy.Policy
+}
+
+// reload reads the config file again and applies its reloadable keys. Nothing is changed if the config file is
+// invalid, held locks are never touched.
+func (r *reloader) reload() error {
+	reloading.Lock()
+	defer reloading.Unlock()
+	if configFile != "" {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return err
+		}
+		if err := applyConfig(cfg, reloadableKeys); err != nil {
+			return err
+		}
+	}
+	if err := applyLogLevel(); err != nil {
+		return err
+	}
+	if err := r.forceTokens.Replace(forceFile, secretToken); err != nil {
+		return fmt.Errorf("force tokens: %w", err)
+	}
+	if r.authenticator != nil && tokenFile != "" {
+		if err := r.authenticator.Reload(tokenFile); err != nil {
+			return fmt.Errorf("token-file: %w", err)
+		}
+	}
+	if r.acl != nil && aclFile != "" {
+		acl, err := auth.LoadACL(aclFile)
+		if err != nil {
+			return fmt.Errorf("acl-file: %w", err)
+		}
+		r.acl.Update(acl)
+	}
+	r.lockServer.SetQuota(limits)
+	if err := r.policies.Replace(r.applied, configPolicies); err != nil {
+		return fmt.Errorf("policies: %w", err)
+	}
+	r.applied = configPolicies
+	return nil
+}
+
+// currentShutdownTimeout returns the shutdown timeout, which may be changed by a reload.
+func currentShutdownTimeout() time.Duration {
+	reloading.Lock()
+	defer reloading.Unlock()
+	return shutdownTimeout
+}
+
+// reloadOnHangup reloads the configuration whenever the process receives SIGHUP.
+func reloadOnHangup(r *reloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := r.reload(); err != nil {
+				slog.Error("failed to reload configuration", "error", err)
+				continue
+			}
+			slog.Info("reloaded configuration", "config", configFile)
+		}
+	}()
+}
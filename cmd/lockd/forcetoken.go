@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sascha-andres/lockutil/internal/auth"
+)
+
+// loadForceTokens returns the force tokens given by -secret-token and -secret-token-file.
+func loadForceTokens() (*auth.ForceTokens, error) {
+	if forceFile == "" {
+		return auth.NewForceTokens(secretToken)
+	}
+	return auth.LoadForceTokens(forceFile, secretToken)
+}
+
+// hashToken reads a token from stdin and prints its bcrypt hash for use in a force token file.
+func hashToken() error {
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("no token given on stdin")
+	}
+	token := strings.TrimSpace(scanner.Text())
+	if token == "" {
+		return errors.New("no token given on stdin")
+	}
+	hash, err := auth.HashToken(token)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
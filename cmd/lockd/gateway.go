@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/sascha-andres/lockutil/internal/dashboard"
+	"github.com/sascha-andres/lockutil/server"
+)
+
+// serveGateway serves the HTTP/JSON gateway of lockServer on addr, using TLS if tlsConfig is set, and with
+// withDashboard the web dashboard at /ui/. The returned server must be shut down on shutdown.
+func serveGateway(addr string, tlsConfig *tls.Config, lockServer *server.LockServer, interceptors []grpc.UnaryServerInterceptor, withDashboard bool) (*http.Server, error) {
+	gateway, err := server.NewGateway(context.Background(), lockServer, interceptors...)
+	if err != nil {
+		return nil, err
+	}
+	handler := http.NewServeMux()
+	handler.Handle("/", gateway)
+	if withDashboard {
+		ui, err := dashboard.Handler()
+		if err != nil {
+			return nil, err
+		}
+		handler.Handle("/ui/", http.StripPrefix("/ui", ui))
+		handler.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+		scheme = "https"
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP gateway failed", "error", err)
+		}
+	}()
+	slog.Info("HTTP gateway running", "url", fmt.Sprintf("%s://%s/v1/", scheme, lis.Addr()))
+	if withDashboard {
+		slog.Info("dashboard available", "url", fmt.Sprintf("%s://%s/ui/", scheme, lis.Addr()))
+	}
+	return srv, nil
+}
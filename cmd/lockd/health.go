@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/cluster"
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+	"github.com/sascha-andres/lockutil/server"
+)
+
+// healthInterval is how often the backend health is checked.
+const healthInterval = time.Second
+
+// registerHealth registers the grpc.health.v1 service. The overall status and the status of the LockService
+// are SERVING while the backend is healthy, in clustered mode while a leader is known, and lockServer is not draining.
+// The returned function updates the status immediately.
+func registerHealth(grpcServer *grpc.Server, node *cluster.Node, lockServer *server.LockServer) (*health.Server, func()) {
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, hs)
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if (node != nil && node.Leader() == "") || lockServer.Draining() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		hs.SetServingStatus("", status)
+		hs.SetServingStatus(pb.LockService_ServiceDesc.ServiceName, status)
+	}
+	update()
+	if node != nil {
+		go func() {
+			ticker := time.NewTicker(healthInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				update()
+			}
+		}()
+	}
+	return hs, update
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/sascha-andres/lockutil/internal/logging"
+)
+
+// level is the level of the lockd logger, updated when the configuration is reloaded.
+var level = new(slog.LevelVar)
+
+// setupLogging installs a logger writing to stderr in the configured format as default logger.
+func setupLogging() error {
+	if err := applyLogLevel(); err != nil {
+		return err
+	}
+	logger, err := logging.New(os.Stderr, logFormat, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger.With("app", applicationName))
+	return nil
+}
+
+// applyLogLevel sets the level of the lockd logger from the log-level flag, verbose forces debug.
+func applyLogLevel() error {
+	l, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		l = slog.LevelDebug
+	}
+	level.Set(l)
+	return nil
+}
+
+// fatal logs msg with args at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -1,17 +1,41 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	pb "github.com/sascha-andres/lockutil/internal/lockserver"
 
 	"net"
 
+	"github.com/sascha-andres/lockutil/internal/audit"
+	"github.com/sascha-andres/lockutil/internal/auth"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/cluster"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/sharded"
+	"github.com/sascha-andres/lockutil/internal/logging"
+	"github.com/sascha-andres/lockutil/internal/metrics"
+	"github.com/sascha-andres/lockutil/internal/peercred"
+	"github.com/sascha-andres/lockutil/internal/policy"
+	"github.com/sascha-andres/lockutil/internal/quota"
+	"github.com/sascha-andres/lockutil/internal/tlsconfig"
+	"github.com/sascha-andres/lockutil/internal/tracing"
 	"github.com/sascha-andres/lockutil/server"
 	"github.com/sascha-andres/reuse/flag"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 )
 
 const (
@@ -24,21 +48,96 @@ var (
 	port        string
 	host        string
 	secretToken string
+	forceFile   string
 	help        bool
 	verbose     bool
+	logLevel    string
+	logFormat   string
+	raftID      string
+	raftPeers   string
+	raftDir     string
+	raftSecret  string
+	file        string
+	backend     string
+	shards      int
+	historySize int
+
+	tlsCert              string
+	tlsKey               string
+	tlsCA                string
+	tlsRequireClientCert bool
+
+	tokenFile string
+	token     string
+	aclFile   string
+
+	limits quota.Limits
+
+	configFile       string
+	metricsListen    string
+	httpListen       string
+	traceConfig      = tracing.Config{ServiceName: applicationName}
+	auditFile        string
+	auditMaxSize     int
+	auditMaxBackups  int
+	enableDashboard  bool
+	enableReflection bool
+	stateFile        string
+	shutdownTimeout  time.Duration
+
+	socket      string
+	socketMode  string
+	socketGroup string
 )
 
-// init initializes the logger settings, environment, and command-line flags for the application.
+// init initializes the environment and command-line flags for the application.
 func init() {
-	log.SetPrefix(fmt.Sprintf("[%s] ", strings.ToUpper(applicationName)))
-	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
 	flag.SetEnvPrefix(strings.ToUpper(applicationName))
 
 	flag.StringVar(&port, "port", defaultPort, "The port to listen on")
 	flag.StringVar(&host, "host", defaultHost, "The host to listen on")
 	flag.StringVar(&secretToken, "secret-token", "", "The secret token to use for forceful unlocks, empty to disable")
+	flag.StringVar(&forceFile, "secret-token-file", "", "File with force tokens, one plain, bcrypt or argon2id hashed token per line, reloaded on SIGHUP")
+	flag.StringVar(&socket, "socket", "", "The Unix socket to listen on instead of host and port, the snapshot commands connect to it")
+	flag.StringVar(&socketMode, "socket-mode", "0660", "The octal file mode of the Unix socket")
+	flag.StringVar(&socketGroup, "socket-group", "", "The group name or ID owning the Unix socket, empty to keep the default group")
 	flag.BoolVar(&help, "help", false, "Prints this help message")
-	flag.BoolVar(&verbose, "verbose", false, "Enables verbose logging")
+	flag.BoolVar(&verbose, "verbose", false, "Enables verbose logging, same as log-level debug")
+	flag.StringVar(&logLevel, "log-level", "info", "The minimum level to log, one of debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", logging.FormatText, "The log format, text or json")
+	flag.StringVar(&raftID, "raft-id", "", "The raft ID of this node, enables clustered mode")
+	flag.StringVar(&raftPeers, "raft-peers", "", "Comma separated cluster members as id@raft-address@grpc-address, including this node")
+	flag.StringVar(&backend, "backend", "inmemory", "The lock backend to use, one of inmemory or sharded")
+	flag.IntVar(&shards, "shards", sharded.DefaultShards, "The number of shards for the sharded backend")
+	flag.IntVar(&historySize, "history-size", history.DefaultSize, "The number of lock events to keep in the history")
+	flag.StringVar(&tlsCert, "tls-cert", "", "The PEM certificate file to serve TLS with, empty to disable TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "The PEM key file of the TLS certificate")
+	flag.StringVar(&tlsCA, "tls-ca", "", "The PEM CA file to verify client certificates with, enables mutual TLS")
+	flag.BoolVar(&tlsRequireClientCert, "tls-require-client-cert", false, "Reject clients not presenting a certificate signed by the TLS CA")
+	flag.StringVar(&tokenFile, "token-file", "", "File mapping bearer tokens to principals, one 'token principal' pair per line, enables authentication")
+	flag.StringVar(&token, "token", "", "The bearer token used for snapshot commands and to forward commands to the cluster leader")
+	flag.StringVar(&aclFile, "acl-file", "", "File with access control rules, one 'principal rights pattern' rule per line, requires token-file")
+	flag.IntVar(&limits.HeldPerClient, "max-locks-per-client", 0, "The maximum number of locks a client principal may hold, 0 for no limit")
+	flag.IntVar(&limits.HeldPerNamespace, "max-locks-per-namespace", 0, "The maximum number of locks held in a namespace, 0 for no limit")
+	flag.IntVar(&limits.WaitingPerClient, "max-waiters-per-client", 0, "The maximum number of waiting lock requests of a client principal, 0 for no limit")
+	flag.IntVar(&limits.WaitingPerNamespace, "max-waiters-per-namespace", 0, "The maximum number of waiting lock requests in a namespace, 0 for no limit")
+	flag.StringVar(&metricsListen, "metrics-listen", "", "The host:port to serve Prometheus metrics on at /metrics, empty to disable")
+	flag.StringVar(&httpListen, "http-listen", "", "The host:port to serve the HTTP/JSON gateway on, empty to disable")
+	flag.BoolVar(&enableDashboard, "dashboard", false, "Serves the web dashboard at /ui/ of the HTTP gateway, requires http-listen")
+	flag.StringVar(&traceConfig.Exporter, "trace-exporter", tracing.ExporterNone, "The OpenTelemetry trace exporter, one of none, otlp or stdout")
+	flag.StringVar(&traceConfig.Endpoint, "trace-endpoint", "", "The host:port of the OTLP collector, empty to use OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317")
+	flag.BoolVar(&traceConfig.Insecure, "trace-insecure", false, "Connect to the OTLP collector without TLS")
+	flag.StringVar(&traceConfig.File, "trace-file", "", "The file the stdout trace exporter appends spans to, empty for stdout")
+	flag.StringVar(&auditFile, "audit-log", "", "The file to append the audit log of privileged operations to as JSON lines, empty to disable")
+	flag.IntVar(&auditMaxSize, "audit-max-size", 100, "The size in megabytes the audit log is rotated at")
+	flag.IntVar(&auditMaxBackups, "audit-max-backups", 10, "The number of rotated audit logs to keep, 0 to keep all")
+	flag.BoolVar(&enableReflection, "reflection", false, "Enables gRPC server reflection")
+	flag.StringVar(&configFile, "config", "", "The YAML config file, flags given on the command line take precedence, reloaded on SIGHUP")
+	flag.StringVar(&stateFile, "state-file", "", "The file to persist the lock state to on shutdown and to restore it from on start")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "The time to wait for running requests on shutdown before closing connections")
+	flag.StringVar(&file, "file", "", "The snapshot file for the snapshot save and restore commands, snapshots hold the held locks but not waiting requests")
+	flag.StringVar(&raftDir, "raft-dir", "", "The directory to store the raft log and stable store (raft.db) and raft snapshots in, empty to keep them in memory")
+	flag.StringVar(&raftSecret, "raft-secret", "", "The secret shared by all cluster nodes, required in clustered mode to accept forwarded commands")
 }
 
 // main is the entry point of the program, handling command-line flag parsing and executing the main functionality.
@@ -49,25 +148,271 @@ func main() {
 		return
 	}
 
-	if err := run(); err != nil {
-		log.Fatalf("Failed to run: %v", err)
+	err := loadConfig()
+	if err != nil {
+		fatal("failed to load config", "error", err)
+	}
+	if err := setupLogging(); err != nil {
+		fatal("failed to set up logging", "error", err)
+	}
+	if verbs := flag.GetVerbs(); len(verbs) > 0 {
+		err = runCommand(verbs)
+	} else {
+		err = run()
+	}
+	if err != nil {
+		fatal("failed to run", "error", err)
 	}
 }
 
 // run starts a gRPC server on the default host and port, registers the LockService, and begins serving client requests.
 func run() error {
-	// Set up a listener on port 50051
-	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%s", host, port))
+	listeners, err := listen()
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := serverTLS()
+	if err != nil {
+		return err
+	}
+	serverOptions := make([]grpc.ServerOption, 0)
+	if tlsConfig != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if hasUnixListener(listeners) {
+		// identify clients on the Unix socket by their process credentials
+		serverOptions = append(serverOptions, grpc.Creds(peercred.NewCredentials()))
+	}
+	tracerProvider, shutdownTracing, err := tracing.NewProvider(context.Background(), traceConfig)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("failed to flush spans", "error", err)
+		}
+	}()
+	serverOptions = append(serverOptions, grpc.StatsHandler(otelgrpc.NewServerHandler(
+		otelgrpc.WithTracerProvider(tracerProvider),
+		otelgrpc.WithPropagators(tracing.Propagator),
+	)))
+	var auditLog *audit.Log
+	if auditFile != "" {
+		auditLog, err = audit.Open(auditFile, auditMaxSize, auditMaxBackups)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = auditLog.Close()
+		}()
+	}
+	unaryInterceptors := make([]grpc.UnaryServerInterceptor, 0)
+	streamInterceptors := make([]grpc.StreamServerInterceptor, 0)
+
+	var lockMetrics *metrics.Metrics
+	if metricsListen != "" {
+		lockMetrics = metrics.New()
+		metricsServer, err := serveMetrics(metricsListen, lockMetrics)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = metricsServer.Close()
+		}()
+		unaryInterceptors = append(unaryInterceptors, server.MetricsUnaryInterceptor(lockMetrics))
+		streamInterceptors = append(streamInterceptors, server.MetricsStreamInterceptor(lockMetrics))
+	}
+
+	var authenticator *server.Authenticator
+	if tokenFile != "" {
+		authenticator, err = server.NewAuthenticator(tokenFile)
+		if err != nil {
+			return err
+		}
+		authenticator.SetAudit(auditLog)
+		unaryInterceptors = append(unaryInterceptors, authenticator.UnaryInterceptor)
+		streamInterceptors = append(streamInterceptors, authenticator.StreamInterceptor)
+	}
 
 	// Create a new gRPC server
-	grpcServer := grpc.NewServer()
+	serverOptions = append(serverOptions, grpc.ChainUnaryInterceptor(unaryInterceptors...), grpc.ChainStreamInterceptor(streamInterceptors...))
+	grpcServer := grpc.NewServer(serverOptions...)
+
+	forceTokens, err := loadForceTokens()
+	if err != nil {
+		return err
+	}
+	policies := policy.NewSet()
+	if err := policies.Replace(nil, configPolicies); err != nil {
+		return err
+	}
+	opts := []server.LockServerOption{server.WithHistorySize(historySize), server.WithQuota(limits), server.WithForceTokens(forceTokens), server.WithPolicies(policies), server.WithMetrics(lockMetrics), server.WithAudit(auditLog)}
+	var acl *auth.ACL
+	if aclFile != "" {
+		if tokenFile == "" {
+			return errors.New("acl-file requires token-file")
+		}
+		acl, err = auth.LoadACL(aclFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, server.WithACL(acl))
+	}
+	switch backend {
+	case "inmemory":
+	case "sharded":
+		opts = append(opts, server.WithLocker(sharded.NewShardedLocker(shards)))
+	default:
+		return fmt.Errorf("unknown backend %q", backend)
+	}
+	var node *cluster.Node
+	if raftID != "" {
+		if stateFile != "" {
+			return errors.New("state-file is not supported in clustered mode, use raft-dir")
+		}
+		if raftSecret == "" {
+			return errors.New("raft-secret is required in clustered mode")
+		}
+		node, err = startCluster(tracerProvider)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = node.Close()
+		}()
+		clusterServer, err := server.NewClusterServer(node, raftSecret, acl, server.WithClusterLogger(slog.Default()))
+		if err != nil {
+			return err
+		}
+		clusterServer.SetAudit(auditLog)
+		pb.RegisterClusterServiceServer(grpcServer, clusterServer)
+		opts = append(opts, server.WithLocker(node))
+	}
 
 	// Register the lock service
-	pb.RegisterLockServiceServer(grpcServer, server.NewLockServer(secretToken, verbose))
+	opts = append(opts, server.WithLogger(slog.Default()), server.WithTracerProvider(tracerProvider))
+	lockServer := server.NewLockServer(secretToken, opts...)
+	pb.RegisterLockServiceServer(grpcServer, lockServer)
+	if err := restoreState(lockServer); err != nil {
+		return err
+	}
+	healthServer, updateHealth := registerHealth(grpcServer, node, lockServer)
+	pb.RegisterAdminServiceServer(grpcServer, server.NewAdminServer(lockServer, server.WithDrainHook(func(bool) { updateHealth() })))
+	if enableReflection {
+		reflection.Register(grpcServer)
+	}
+	var httpServer *http.Server
+	if enableDashboard && httpListen == "" {
+		return errors.New("dashboard requires http-listen")
+	}
+	if httpListen != "" {
+		httpServer, err = serveGateway(httpListen, tlsConfig, lockServer, unaryInterceptors, enableDashboard)
+		if err != nil {
+			return err
+		}
+	}
+	reloadOnHangup(&reloader{forceTokens: forceTokens, authenticator: authenticator, acl: acl, lockServer: lockServer, policies: policies, applied: configPolicies})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		slog.Info("gRPC server running", "network", lis.Addr().Network(), "addr", lis.Addr().String())
+		go func(lis net.Listener) {
+			errs <- grpcServer.Serve(lis)
+		}(lis)
+	}
+	notifyReady()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	notifyStopping()
+	return shutdown(grpcServer, httpServer, healthServer, lockServer, node)
+}
+
+// listen returns the listeners passed by systemd socket activation or, if lockd was not socket activated,
+// a listener on the Unix socket or host and port.
+func listen() ([]net.Listener, error) {
+	listeners, err := activatedListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		return listeners, nil
+	}
+	var lis net.Listener
+	if socket != "" {
+		lis, err = listenUnix(socket, socketMode, socketGroup)
+	} else {
+		lis, err = net.Listen("tcp", fmt.Sprintf("%s:%s", host, port))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{lis}, nil
+}
+
+// hasUnixListener reports whether any of the listeners is a Unix socket.
+func hasUnixListener(listeners []net.Listener) bool {
+	for _, lis := range listeners {
+		if lis.Addr().Network() == "unix" {
+			return true
+		}
+	}
+	return false
+}
+
+// runCommand executes an administrative command.
+func runCommand(verbs []string) error {
+	switch verbs[0] {
+	case "snapshot":
+		return runSnapshot(verbs)
+	case "hash-token":
+		return hashToken()
+	}
+	return fmt.Errorf("unknown command %q", verbs[0])
+}
+
+// startCluster starts a raft node for this lockd instance using the configured peers, forwarded commands are
+// traced using tp.
+func startCluster(tp trace.TracerProvider) (*cluster.Node, error) {
+	peers, err := cluster.ParsePeers(raftPeers)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("starting cluster node", "raft_id", raftID, "peers", len(peers))
+	cfg := cluster.Config{
+		ID:             raftID,
+		Peers:          peers,
+		DataDir:        raftDir,
+		Token:          token,
+		Secret:         raftSecret,
+		Logger:         slog.Default(),
+		TracerProvider: tp,
+	}
+	if tlsCert != "" {
+		// nodes authenticate to each other using the server certificate
+		tlsConfig, err := tlsconfig.Client(tlsCA, tlsCert, tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Credentials = credentials.NewTLS(tlsConfig)
+	}
+	return cluster.NewNode(cfg)
+}
 
-	log.Printf("gRPC server running on port %q:%q...", host, port)
-	return grpcServer.Serve(lis)
+// serverTLS returns the server TLS configuration, nil if no certificate is configured.
+func serverTLS() (*tls.Config, error) {
+	if tlsCert == "" && tlsKey == "" {
+		if tlsCA != "" {
+			return nil, errors.New("tls-ca requires tls-cert and tls-key")
+		}
+		return nil, nil
+	}
+	return tlsconfig.Server(tlsCert, tlsKey, tlsCA, tlsRequireClientCert)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/metrics"
+)
+
+// serveMetrics exposes m on /metrics of an HTTP listener at addr. The returned server must be closed on shutdown.
+func serveMetrics(addr string, m *metrics.Metrics) (*http.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics listener failed", "error", err)
+		}
+	}()
+	slog.Info("metrics available", "url", fmt.Sprintf("http://%s/metrics", lis.Addr()))
+	return srv, nil
+}
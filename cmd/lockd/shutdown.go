@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/cluster"
+	"github.com/sascha-andres/lockutil/server"
+)
+
+// shutdown reports NOT_SERVING to health checks, drains the lock server, stops the gRPC server and the HTTP gateway,
+// if one is running, and persists the lock state. Running requests get shutdownTimeout to finish before all
+// connections are closed.
+func shutdown(grpcServer *grpc.Server, httpServer *http.Server, healthServer *health.Server, lockServer *server.LockServer, node *cluster.Node) error {
+	timeout := currentShutdownTimeout()
+	slog.Info("shutting down, waiting for running requests", "timeout", timeout)
+	healthServer.Shutdown()
+	lockServer.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		if httpServer != nil {
+			_ = httpServer.Shutdown(ctx)
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("running requests did not finish in time, closing connections", "timeout", timeout)
+		grpcServer.Stop()
+		if httpServer != nil {
+			_ = httpServer.Close()
+		}
+	}
+
+	// persist once no request can change the lock state anymore
+	if err := persistState(lockServer, node); err != nil {
+		slog.Error("failed to persist lock state", "error", err)
+		return err
+	}
+	return nil
+}
+
+// persistState writes the lock state to the state file or, in clustered mode with a raft directory, takes a
+// raft snapshot. Without a durable backend nothing is persisted.
+func persistState(lockServer *server.LockServer, node *cluster.Node) error {
+	if node != nil {
+		if raftDir == "" {
+			return nil
+		}
+		return node.Snapshot()
+	}
+	if stateFile == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(stateFile), filepath.Base(stateFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := lockServer.WriteState(context.Background(), tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	slog.Debug("persisted lock state", "file", stateFile)
+	return os.Rename(tmp.Name(), stateFile)
+}
+
+// restoreState loads the lock state from the state file if it exists.
+func restoreState(lockServer *server.LockServer) error {
+	if stateFile == "" {
+		return nil
+	}
+	f, err := os.Open(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := lockServer.ReadState(context.Background(), f); err != nil {
+		return err
+	}
+	slog.Info("restored lock state", "file", stateFile)
+	return nil
+}
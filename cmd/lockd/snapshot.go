@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/sascha-andres/lockutil"
+)
+
+// runSnapshot saves or restores the lock state of a running lockd instance, connecting to its Unix socket if
+// -socket is given and to host and port otherwise.
+func runSnapshot(verbs []string) error {
+	if len(verbs) < 2 {
+		return errors.New("please specify 'save' or 'restore' for the snapshot command")
+	}
+	if file == "" {
+		return errors.New("a snapshot file is required")
+	}
+
+	opts := []lockutil.ClientOption{lockutil.WithHost(host), lockutil.WithPort(port)}
+	if socket != "" {
+		opts = append(opts, lockutil.WithSocket(socket))
+	}
+	if tlsCert != "" || tlsCA != "" {
+		opts = append(opts, lockutil.WithTLS(tlsCA))
+	}
+	if tlsCert != "" {
+		opts = append(opts, lockutil.WithClientCertificate(tlsCert, tlsKey))
+	}
+	if token != "" {
+		opts = append(opts, lockutil.WithToken(token))
+	}
+	c, err := lockutil.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.Close(); err != nil {
+			slog.Warn("failed to close connection", "error", err)
+		}
+	}()
+
+	switch verbs[1] {
+	case "save":
+		return saveSnapshot(c)
+	case "restore":
+		return restoreSnapshot(c)
+	}
+	return fmt.Errorf("unknown snapshot command %q", verbs[1])
+}
+
+// saveSnapshot writes the lock state of the lockd instance to the snapshot file.
+func saveSnapshot(c *lockutil.Client) error {
+	data, err := c.SaveSnapshot(secretToken)
+	if err != nil {
+		return err
+	}
+	slog.Debug("writing snapshot", "server", c.String(), "file", file)
+	return os.WriteFile(file, data, 0o600)
+}
+
+// restoreSnapshot loads the snapshot file into the lockd instance, replacing all of its locks.
+func restoreSnapshot(c *lockutil.Client) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	slog.Debug("restoring snapshot", "file", file, "server", c.String())
+	return c.RestoreSnapshot(secretToken, data)
+}
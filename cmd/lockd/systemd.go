@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// activatedListeners returns the listeners passed by systemd socket activation (LISTEN_FDS), empty when lockd
+// was not socket activated.
+func activatedListeners() ([]net.Listener, error) {
+	inherited, err := activation.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0, len(inherited))
+	for _, lis := range inherited {
+		// file descriptors that are not stream sockets are passed as nil
+		if lis != nil {
+			listeners = append(listeners, lis)
+		}
+	}
+	return listeners, nil
+}
+
+// notifyReady tells systemd that lockd is ready to serve requests and starts sending watchdog keep-alives
+// if the unit configures WatchdogSec. Without NOTIFY_SOCKET nothing is sent.
+func notifyReady() {
+	if _, err := daemon.SdNotify(false, daemon.SdNotifyReady); err != nil {
+		slog.Warn("failed to notify systemd", "error", err)
+	}
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		slog.Warn("invalid watchdog configuration", "error", err)
+		return
+	}
+	if interval <= 0 {
+		return
+	}
+	slog.Debug("sending watchdog keep-alives", "interval", interval/2)
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := daemon.SdNotify(false, daemon.SdNotifyWatchdog); err != nil {
+				slog.Warn("failed to send watchdog keep-alive", "error", err)
+			}
+		}
+	}()
+}
+
+// notifyStopping tells systemd that lockd is shutting down.
+func notifyStopping() {
+	_, _ = daemon.SdNotify(false, daemon.SdNotifyStopping)
+}
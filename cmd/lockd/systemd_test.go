@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// activationChildEnv makes the test binary act as a socket activated lockd, see TestActivatedListeners.
+const activationChildEnv = "LOCKD_TEST_ACTIVATION_CHILD"
+
+// TestActivatedListeners passes a listening socket like systemd does, as file descriptor 3 of a new process with
+// LISTEN_FDS set, and checks that the process picks it up.
+func TestActivatedListeners(t *testing.T) {
+	if os.Getenv(activationChildEnv) != "" {
+		activationChild()
+		return
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer func() {
+		_ = lis.Close()
+	}()
+	f, err := lis.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("getting listener file: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivatedListeners$")
+	cmd.Env = append(os.Environ(), activationChildEnv+"=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=lockd.socket")
+	cmd.ExtraFiles = []*os.File{f}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running activated process: %v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); !strings.HasPrefix(got, "listener "+lis.Addr().String()) {
+		t.Errorf("expected the process to use the passed listener %s, got %q", lis.Addr(), got)
+	}
+}
+
+// activationChild prints the address of the activated listeners and exits. systemd sets LISTEN_PID to the pid of
+// the activated process, which is only known once it runs.
+func activationChild() {
+	_ = os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	listeners, err := activatedListeners()
+	if err != nil || len(listeners) != 1 {
+		os.Stdout.WriteString("no listener passed\n")
+		os.Exit(1)
+	}
+	os.Stdout.WriteString("listener " + listeners[0].Addr().String() + "\n")
+	os.Exit(0)
+}
+
+func TestActivatedListenersWithoutActivation(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+	listeners, err := activatedListeners()
+	if err != nil || len(listeners) != 0 {
+		t.Fatalf("expected no listeners without activation, got %v, %v", listeners, err)
+	}
+}
+
+// TestNotify receives the notifications of lockd on a fake NOTIFY_SOCKET.
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listening on notify socket: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	// the watchdog goroutine keeps running, it sends nothing once the environment is restored
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	receive := func(expected string) {
+		t.Helper()
+		buf := make([]byte, 256)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", expected, err)
+		}
+		if got := string(buf[:n]); got != expected {
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+	notifyReady()
+	receive("READY=1")
+	// keep-alives are sent at half the watchdog interval
+	receive("WATCHDOG=1")
+	receive("WATCHDOG=1")
+	notifyStopping()
+	for {
+		buf := make([]byte, 256)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("waiting for STOPPING=1: %v", err)
+		}
+		// keep-alives sent meanwhile are skipped
+		if got := string(buf[:n]); got == "STOPPING=1" {
+			return
+		}
+	}
+}
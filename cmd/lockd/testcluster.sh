@@ -0,0 +1,26 @@
+#!/usr/bin/env fish
+
+go build -o lockd_test .
+go build -o lock_test ../lock
+
+set -x LOCKD_RAFT_SECRET (random)(random)(random)
+set peers n1@127.0.0.1:7001@127.0.0.1:51001,n2@127.0.0.1:7002@127.0.0.1:51002,n3@127.0.0.1:7003@127.0.0.1:51003
+
+./lockd_test -raft-id n1 -raft-peers $peers -port 51001 &
+./lockd_test -raft-id n2 -raft-peers $peers -port 51002 &
+./lockd_test -raft-id n3 -raft-peers $peers -port 51003 &
+
+sleep 5
+
+./lock_test -verbose -port 51001
+./lock_test -verbose -timeout 2 -port 51002
+
+./lock_test list -port 51003
+
+./lock_test release -verbose -port 51002
+
+./lock_test list -addresses 127.0.0.1:51001,127.0.0.1:51002,127.0.0.1:51003
+
+kill (jobs -p)
+
+rm lockd_test lock_test
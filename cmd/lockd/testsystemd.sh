@@ -0,0 +1,34 @@
+#!/usr/bin/env fish
+
+go build -o lockd_test .
+go build -o lock_test ../lock
+
+set dir (mktemp -d)
+
+# receive sd_notify messages on a datagram socket like systemd does
+python3 -c "
+import socket, sys
+s = socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM)
+s.bind(sys.argv[1])
+while True:
+    print('notify:', s.recv(1024).decode(), flush=True)
+" $dir/notify &
+
+sleep 1
+
+# pass a TCP and a Unix listener like lockd.socket does
+systemd-socket-activate -l 127.0.0.1:51101 -l $dir/lockd.sock \
+    -E NOTIFY_SOCKET=$dir/notify -E WATCHDOG_USEC=2000000 \
+    ./lockd_test -verbose &
+
+sleep 1
+
+./lock_test -verbose -port 51101
+./lock_test list -socket $dir/lockd.sock
+./lock_test release -verbose -port 51101
+
+sleep 3
+
+kill (jobs -p)
+
+rm -r $dir lockd_test lock_test
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Action is a privileged operation recorded in the audit log.
+type Action string
+
+const (
+
+	// ActionAuthenticate is the validation of a bearer token.
+	ActionAuthenticate Action = "authenticate"
+
+	// ActionAuthorize is the check of an ACL right, only denials are recorded.
+	ActionAuthorize Action = "authorize"
+
+	// ActionForceRelease is the release of a lock held by someone else.
+	ActionForceRelease Action = "force-release"
+
+	// ActionSnapshotSave is the export of the lock state.
+	ActionSnapshotSave Action = "snapshot-save"
+
+	// ActionSnapshotRestore is the replacement of the lock state by a snapshot.
+	ActionSnapshotRestore Action = "snapshot-restore"
+
+	// ActionReleaseOwner is the release of all locks of an owner.
+	ActionReleaseOwner Action = "release-owner"
+
+	// ActionDrain is a node starting to reject new lock requests.
+	ActionDrain Action = "drain"
+
+	// ActionResume is a node accepting lock requests again after draining.
+	ActionResume Action = "resume"
+
+	// ActionSetPolicy is adding, replacing or removing a lock policy.
+	ActionSetPolicy Action = "set-policy"
+
+	// ActionDumpState is the export of locks, waiters and policies of a node.
+	ActionDumpState Action = "dump-state"
+)
+
+// Outcome is the result of an audited operation.
+type Outcome string
+
+const (
+
+	// OutcomeSuccess means the operation was performed.
+	OutcomeSuccess Outcome = "success"
+
+	// OutcomeDenied means the caller was not allowed to perform the operation.
+	OutcomeDenied Outcome = "denied"
+
+	// OutcomeFailed means the operation was allowed but did not succeed.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Entry is a single line of the audit log.
+type Entry struct {
+
+	// Time is the point in time the operation finished, set by Record if zero.
+	Time time.Time `json:"time"`
+
+	// Action is the audited operation.
+	Action Action `json:"action"`
+
+	// Outcome is the result of the operation.
+	Outcome Outcome `json:"outcome"`
+
+	// Principal is the authenticated caller, empty without authentication.
+	Principal string `json:"principal,omitempty"`
+
+	// Remote is the address of the caller.
+	Remote string `json:"remote"`
+
+	// Right is the ACL right checked for ActionAuthorize.
+	Right string `json:"right,omitempty"`
+
+	// Namespace is the namespace of the affected lock.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Lock is the name of the affected lock.
+	Lock string `json:"lock,omitempty"`
+
+	// Detail describes the outcome, e.g. why it was denied.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Log writes audit entries as JSON lines. All methods may be called on a nil *Log, doing nothing.
+type Log struct {
+
+	// mu serializes writes, so concurrent entries never interleave.
+	mu sync.Mutex
+
+	// w receives the JSON lines.
+	w io.Writer
+}
+
+// New creates a Log writing to w.
+func New(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Open creates a Log appending to the file at path. The file is rotated once it grows beyond maxSizeMB, keeping
+// maxBackups rotated files, 0 keeps all of them. The file is created with mode 0600 if it does not exist.
+func Open(path string, maxSizeMB, maxBackups int) (*Log, error) {
+	// fail on start instead of on the first entry if the file cannot be written
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return New(&lumberjack.Logger{
+		Filename:   filepath.Clean(path),
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+	}), nil
+}
+
+// Record writes e as a single JSON line. Write errors are logged, they do not fail the audited operation.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("failed to encode audit entry", "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		slog.Error("failed to write audit entry", "action", e.Action, "error", err)
+	}
+}
+
+// Close closes the underlying file if the Log was created by Open.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
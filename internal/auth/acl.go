@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Right is a permission granted by an ACL rule.
+type Right string
+
+const (
+
+	// RightAcquire allows acquiring locks.
+	RightAcquire Right = "acquire"
+
+	// RightRelease allows releasing own locks.
+	RightRelease Right = "release"
+
+	// RightList allows seeing locks in listings and their history.
+	RightList Right = "list"
+
+	// RightForceRelease allows releasing locks held by others.
+	RightForceRelease Right = "force-release"
+
+	// RightAdmin allows administrative operations like saving and restoring snapshots, granted on the pattern *.
+	RightAdmin Right = "admin"
+
+	// RightCluster allows lockd nodes to forward commands to the cluster leader, granted on the pattern *.
+	RightCluster Right = "cluster"
+)
+
+// AnyLock is the namespace and lock name used to check rights that are not bound to a single lock.
+const AnyLock = "*"
+
+// rights lists all known rights, used to expand the * wildcard.
+var rights = []Right{RightAcquire, RightRelease, RightList, RightForceRelease, RightAdmin, RightCluster}
+
+// ACL grants principals rights on lock names matching glob patterns. Everything not granted is denied.
+type ACL struct {
+	mu    sync.RWMutex
+	rules []rule
+}
+
+// rule grants rights on a lock name pattern to a principal.
+type rule struct {
+	principal        string
+	rights           map[Right]bool
+	namespacePattern string
+	pattern          string
+}
+
+// LoadACL reads an ACL file. Each non-empty line not starting with # holds a principal, a comma separated list of
+// rights and a lock name pattern, separated by whitespace. The principal * matches every authenticated principal,
+// the right * grants all rights. In patterns * matches any sequence of characters and ? matches a single character.
+// A pattern may be prefixed with a namespace pattern and a colon, e.g. team-a:*, otherwise it applies to all namespaces.
+func LoadACL(path string) (*ACL, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	acl := &ACL{rules: make([]rule, 0)}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected a principal, rights and a lock name pattern", path, line)
+		}
+		r, err := newRule(fields[0], fields[1], fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		acl.rules = append(acl.rules, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// newRule parses the rights of a rule.
+func newRule(principal, rightList, pattern string) (rule, error) {
+	r := rule{principal: principal, rights: make(map[Right]bool), namespacePattern: "*", pattern: pattern}
+	if namespace, name, found := strings.Cut(pattern, ":"); found {
+		r.namespacePattern, r.pattern = namespace, name
+	}
+	for _, name := range strings.Split(rightList, ",") {
+		if name == "*" {
+			for _, right := range rights {
+				r.rights[right] = true
+			}
+			continue
+		}
+		known := false
+		for _, right := range rights {
+			if Right(name) == right {
+				r.rights[right] = true
+				known = true
+			}
+		}
+		if !known {
+			return r, fmt.Errorf("unknown right %q", name)
+		}
+	}
+	return r, nil
+}
+
+// Allowed reports whether principal has right on the lock with the given namespace and name. Unauthenticated
+// callers, represented by an empty principal, are denied.
+func (a *ACL) Allowed(principal string, right Right, namespace, name string) bool {
+	if principal == "" {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, r := range a.rules {
+		if (r.principal == "*" || r.principal == principal) && r.rights[right] && Match(r.namespacePattern, namespace) && Match(r.pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update replaces the rules of the ACL with the rules of other, e.g. after reloading the ACL file.
+func (a *ACL) Update(other *ACL) {
+	other.mu.RLock()
+	rules := other.rules
+	other.mu.RUnlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = rules
+}
+
+// Match reports whether name matches the glob pattern, where * matches any sequence of characters including /
+// and ? matches a single character.
+func Match(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if Match(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// principalKey is the context key holding the authenticated principal.
+type principalKey struct{}
+
+// Tokens maps bearer tokens to the principals they authenticate.
+type Tokens struct {
+	mu      sync.RWMutex
+	entries []entry
+}
+
+// entry is a single token of a token file.
+type entry struct {
+	token     []byte
+	principal string
+}
+
+// LoadTokens reads a token file. Each non-empty line not starting with # holds a token and the principal it
+// authenticates, separated by whitespace.
+func LoadTokens(path string) (*Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	t := &Tokens{entries: make([]entry, 0)}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a principal", path, line)
+		}
+		t.entries = append(t.entries, entry{token: []byte(fields[0]), principal: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Principal returns the principal authenticated by token. All tokens are compared in constant time.
+func (t *Tokens) Principal(token string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	principal, found := "", false
+	for _, e := range t.entries {
+		if subtle.ConstantTimeCompare(e.token, []byte(token)) == 1 && !found {
+			principal, found = e.principal, true
+		}
+	}
+	return principal, found
+}
+
+// Update replaces the tokens with the tokens of other, e.g. after reloading the token file.
+func (t *Tokens) Update(other *Tokens) {
+	other.mu.RLock()
+	entries := other.entries
+	other.mu.RUnlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = entries
+}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal of a request, empty if the request is not authenticated.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// BearerToken sends a token as bearer authorization with every gRPC call, it implements credentials.PerRPCCredentials.
+type BearerToken struct {
+
+	// Token is the token to send.
+	Token string
+
+	// RequireTLS refuses to send the token over connections without transport security.
+	RequireTLS bool
+}
+
+// GetRequestMetadata returns the authorization metadata for a call.
+func (b BearerToken) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + b.Token}, nil
+}
+
+// RequireTransportSecurity reports whether the token may only be sent over secured connections.
+func (b BearerToken) RequireTransportSecurity() bool {
+	return b.RequireTLS
+}
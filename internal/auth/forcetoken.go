@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+
+	// maxArgon2Memory is the largest argon2id memory parameter in KiB accepted, 64 MiB.
+	maxArgon2Memory = 64 << 10
+
+	// maxArgon2Iterations is the largest argon2id iterations parameter accepted.
+	maxArgon2Iterations = 16
+
+	// maxTokenLength is the length of the longest token presented for verification.
+	maxTokenLength = 512
+
+	// maxConcurrentVerifications bounds the presented tokens checked against hashes at the same time, so bogus
+	// tokens sent in parallel cannot exhaust the CPU and memory of lockd.
+	maxConcurrentVerifications = 4
+
+	// minArgon2Salt is the shortest argon2id salt in bytes accepted.
+	minArgon2Salt = 8
+
+	// minArgon2Hash and maxArgon2Hash bound the length of an argon2id hash in bytes.
+	minArgon2Hash, maxArgon2Hash = 16, 1024
+)
+
+// ForceTokens holds the tokens accepted for forced releases and snapshots. Tokens are kept as bcrypt or argon2id
+// hashes or, for compatibility with -secret-token, as plain values. Several tokens may be active at the same
+// time to allow rotation. ForceTokens is safe for concurrent use and can be replaced atomically by Reload.
+type ForceTokens struct {
+
+	// mu guards path, static, verifiers and hashed.
+	mu        sync.RWMutex
+	path      string
+	static    []string
+	verifiers []verifier
+
+	// hashed is set if any configured token is a bcrypt or argon2id hash.
+	hashed bool
+
+	// verifying limits concurrent checks against hashes to maxConcurrentVerifications.
+	verifying chan struct{}
+}
+
+// verifier checks a presented token against one configured token.
+type verifier func(token []byte) bool
+
+// NewForceTokens creates ForceTokens accepting the given plain or hashed tokens, empty values are ignored.
+func NewForceTokens(tokens ...string) (*ForceTokens, error) {
+	ft := &ForceTokens{verifying: make(chan struct{}, maxConcurrentVerifications)}
+	return ft, ft.Replace("", tokens...)
+}
+
+// LoadForceTokens creates ForceTokens from a file and the given plain or hashed tokens. Each non-empty line of the
+// file not starting with # holds one token. Reload reads the file again.
+func LoadForceTokens(path string, tokens ...string) (*ForceTokens, error) {
+	ft := &ForceTokens{verifying: make(chan struct{}, maxConcurrentVerifications)}
+	return ft, ft.Replace(path, tokens...)
+}
+
+// Reload parses the configured tokens and reads the token file again. On error the active tokens are kept.
+func (ft *ForceTokens) Reload() error {
+	ft.mu.RLock()
+	path := ft.path
+	ft.mu.RUnlock()
+	return ft.ReloadFile(path)
+}
+
+// ReloadFile switches to the token file at path and reloads the tokens. On error the active tokens and file are kept.
+func (ft *ForceTokens) ReloadFile(path string) error {
+	ft.mu.RLock()
+	static := ft.static
+	ft.mu.RUnlock()
+	return ft.Replace(path, static...)
+}
+
+// Replace switches to the token file at path, empty for none, and the given plain or hashed tokens, empty values
+// are ignored. On error the active tokens and file are kept.
+func (ft *ForceTokens) Replace(path string, tokens ...string) error {
+	static := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token != "" {
+			static = append(static, token)
+		}
+	}
+	verifiers, hashed, err := load(path, static)
+	if err != nil {
+		return err
+	}
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.path = path
+	ft.static = static
+	ft.verifiers = verifiers
+	ft.hashed = hashed
+	return nil
+}
+
+// load parses the given tokens and the tokens of the file at path, if not empty. hashed reports whether any of
+// them is a hash.
+func load(path string, static []string) (verifiers []verifier, hashed bool, err error) {
+	tokens := append([]string{}, static...)
+	if path != "" {
+		fromFile, err := readTokenFile(path)
+		if err != nil {
+			return nil, false, err
+		}
+		tokens = append(tokens, fromFile...)
+	}
+	verifiers = make([]verifier, 0, len(tokens))
+	for _, token := range tokens {
+		v, err := newVerifier(token)
+		if err != nil {
+			return nil, false, err
+		}
+		verifiers = append(verifiers, v)
+		hashed = hashed || strings.HasPrefix(token, "$")
+	}
+	return verifiers, hashed, nil
+}
+
+// Enabled reports whether at least one token is configured.
+func (ft *ForceTokens) Enabled() bool {
+	if ft == nil {
+		return false
+	}
+	ft.mu.RLock()
+	defer ft.mu.RUnlock()
+	return len(ft.verifiers) > 0
+}
+
+// Verify reports whether token matches any configured token. Every configured token is checked so the time taken
+// does not reveal which token matched. Malformed tokens are rejected without hashing, checks against hashes wait
+// while maxConcurrentVerifications others are running.
+func (ft *ForceTokens) Verify(token string) bool {
+	if ft == nil || !wellFormed(token) {
+		return false
+	}
+	ft.mu.RLock()
+	verifiers, hashed := ft.verifiers, ft.hashed
+	ft.mu.RUnlock()
+	if len(verifiers) == 0 {
+		return false
+	}
+	if hashed {
+		ft.verifying <- struct{}{}
+		defer func() {
+			<-ft.verifying
+		}()
+	}
+	presented := []byte(token)
+	valid := false
+	for _, v := range verifiers {
+		if v(presented) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// wellFormed reports whether token could be a configured token: not empty, at most maxTokenLength bytes of valid
+// UTF-8 without control characters.
+func wellFormed(token string) bool {
+	if token == "" || len(token) > maxTokenLength || !utf8.ValidString(token) {
+		return false
+	}
+	return strings.IndexFunc(token, unicode.IsControl) < 0
+}
+
+// HashToken returns the bcrypt hash of token for use in a force token file.
+func HashToken(token string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// readTokenFile reads one token per line, ignoring empty lines and lines starting with #.
+func readTokenFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	tokens := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		tokens = append(tokens, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// newVerifier returns a verifier for a bcrypt hash ($2a$, $2b$, $2y$), an argon2id hash in PHC format
+// ($argon2id$v=19$m=65536,t=3,p=4$salt$hash) or a plain token.
+func newVerifier(token string) (verifier, error) {
+	switch {
+	case strings.HasPrefix(token, "$2a$"), strings.HasPrefix(token, "$2b$"), strings.HasPrefix(token, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(token)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		hash := []byte(token)
+		return func(presented []byte) bool {
+			return bcrypt.CompareHashAndPassword(hash, presented) == nil
+		}, nil
+	case strings.HasPrefix(token, "$argon2id$"):
+		return newArgon2Verifier(token)
+	case strings.HasPrefix(token, "$"):
+		return nil, errors.New("unsupported token hash, use bcrypt or argon2id")
+	}
+	plain := []byte(token)
+	return func(presented []byte) bool {
+		return subtle.ConstantTimeCompare(plain, presented) == 1
+	}, nil
+}
+
+// newArgon2Verifier parses an argon2id hash in PHC format. Parameters that would make argon2 fail or exhaust the
+// memory of lockd when verifying are rejected.
+func newArgon2Verifier(token string) (verifier, error) {
+	parts := strings.Split(token, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2id version")
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	if threads == 0 {
+		return nil, errors.New("invalid argon2id parameters: p must be at least 1")
+	}
+	if iterations == 0 || iterations > maxArgon2Iterations {
+		return nil, fmt.Errorf("invalid argon2id parameters: t must be between 1 and %d", maxArgon2Iterations)
+	}
+	if memory < 8*uint32(threads) || memory > maxArgon2Memory {
+		return nil, fmt.Errorf("invalid argon2id parameters: m must be between 8*p and %d", maxArgon2Memory)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if len(salt) < minArgon2Salt {
+		return nil, fmt.Errorf("invalid argon2id salt: must be at least %d bytes", minArgon2Salt)
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	if len(hash) < minArgon2Hash || len(hash) > maxArgon2Hash {
+		return nil, fmt.Errorf("invalid argon2id hash: must be between %d and %d bytes", minArgon2Hash, maxArgon2Hash)
+	}
+	return func(presented []byte) bool {
+		computed := argon2.IDKey(presented, salt, iterations, memory, threads, uint32(len(hash)))
+		return subtle.ConstantTimeCompare(hash, computed) == 1
+	}, nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2Hash returns the PHC encoding of token hashed with the given parameters.
+func argon2Hash(token string, memory, iterations uint32, threads uint8) string {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte(token), salt, iterations, memory, threads, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, iterations, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
+}
+
+func TestArgon2Verifier(t *testing.T) {
+	ft, err := NewForceTokens(argon2Hash("secret", 64, 1, 1))
+	if err != nil {
+		t.Fatalf("loading valid hash: %v", err)
+	}
+	if !ft.Verify("secret") || ft.Verify("other") {
+		t.Error("valid hash does not verify as expected")
+	}
+}
+
+func TestArgon2VerifierRejectsInvalidHashes(t *testing.T) {
+	valid := argon2Hash("secret", 64, 1, 1)
+	parts := strings.Split(valid, "$")
+	with := func(i int, value string) string {
+		changed := append([]string{}, parts...)
+		changed[i] = value
+		return strings.Join(changed, "$")
+	}
+	for name, token := range map[string]string{
+		"zero parallelism":    with(3, "m=64,t=1,p=0"),
+		"parallelism too big": with(3, "m=64,t=1,p=256"),
+		"zero iterations":     with(3, "m=64,t=0,p=1"),
+		"too many iterations": with(3, "m=64,t=1000,p=1"),
+		"memory below 8*p":    with(3, "m=16,t=1,p=4"),
+		"memory too big":      with(3, "m=131072,t=1,p=1"),
+		"short salt":          with(4, base64.RawStdEncoding.EncodeToString([]byte("salt"))),
+		"empty hash":          with(5, ""),
+		"short hash":          with(5, base64.RawStdEncoding.EncodeToString([]byte("short"))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewForceTokens(token); err == nil {
+				t.Errorf("expected %q to be rejected", token)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMalformedTokens(t *testing.T) {
+	ft, err := NewForceTokens("token", argon2Hash("hashed", 64, 1, 1))
+	if err != nil {
+		t.Fatalf("creating force tokens: %v", err)
+	}
+	for name, token := range map[string]string{
+		"empty":             "",
+		"too long":          strings.Repeat("t", maxTokenLength+1),
+		"invalid utf-8":     "token\xff",
+		"control character": "token\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if ft.Verify(token) {
+				t.Errorf("expected %q to be rejected", token)
+			}
+		})
+	}
+	if !ft.Verify("token") || !ft.Verify("hashed") {
+		t.Errorf("expected configured tokens to be accepted")
+	}
+}
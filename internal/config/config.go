@@ -0,0 +1,475 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/cluster"
+	"github.com/sascha-andres/lockutil/internal/logging"
+	"github.com/sascha-andres/lockutil/internal/policy"
+	"github.com/sascha-andres/lockutil/internal/quota"
+	"github.com/sascha-andres/lockutil/internal/tracing"
+)
+
+// Config is the content of a lockd configuration file. Unset values keep the defaults of the matching flags.
+type Config struct {
+
+	// Verbose enables verbose logging, same as log level debug.
+	Verbose bool `yaml:"verbose"`
+
+	// Log configures the log output.
+	Log Log `yaml:"log"`
+
+	// Listen configures where lockd accepts connections.
+	Listen Listen `yaml:"listen"`
+
+	// Backend configures how locks are stored.
+	Backend Backend `yaml:"backend"`
+
+	// Cluster configures clustered mode.
+	Cluster Cluster `yaml:"cluster"`
+
+	// TLS configures transport security.
+	TLS TLS `yaml:"tls"`
+
+	// Auth configures authentication, access control and force tokens.
+	Auth Auth `yaml:"auth"`
+
+	// Limits configures quotas.
+	Limits Limits `yaml:"limits"`
+
+	// Policies restrict lock requests for matching locks, the first matching policy applies.
+	Policies []Policy `yaml:"policies"`
+
+	// Metrics configures the Prometheus metrics listener.
+	Metrics Metrics `yaml:"metrics"`
+
+	// HTTP configures the HTTP/JSON gateway.
+	HTTP HTTP `yaml:"http"`
+
+	// Tracing configures the OpenTelemetry trace exporter.
+	Tracing Tracing `yaml:"tracing"`
+
+	// Audit configures the audit log of privileged operations.
+	Audit Audit `yaml:"audit"`
+
+	// Reflection enables gRPC server reflection.
+	Reflection bool `yaml:"reflection"`
+
+	// ShutdownTimeout is the time to wait for running requests on shutdown, e.g. 10s.
+	ShutdownTimeout string `yaml:"shutdown_timeout"`
+}
+
+// Log configures the log output.
+type Log struct {
+
+	// Level is the minimum level logged, one of debug, info, warn or error.
+	Level string `yaml:"level"`
+
+	// Format is the log format, text or json.
+	Format string `yaml:"format"`
+}
+
+// Listen configures where lockd accepts connections.
+type Listen struct {
+
+	// Host is the host to listen on.
+	Host string `yaml:"host"`
+
+	// Port is the TCP port to listen on.
+	Port int `yaml:"port"`
+
+	// Socket is the Unix socket to listen on instead of host and port.
+	Socket string `yaml:"socket"`
+
+	// SocketMode is the octal file mode of the Unix socket.
+	SocketMode string `yaml:"socket_mode"`
+
+	// SocketGroup is the group name or ID owning the Unix socket.
+	SocketGroup string `yaml:"socket_group"`
+}
+
+// Backend configures how locks are stored.
+type Backend struct {
+
+	// Type is the lock backend, inmemory or sharded.
+	Type string `yaml:"type"`
+
+	// Shards is the number of shards of the sharded backend.
+	Shards int `yaml:"shards"`
+
+	// HistorySize is the number of lock events kept in the history.
+	HistorySize int `yaml:"history_size"`
+
+	// StateFile is the file the lock state is persisted to on shutdown.
+	StateFile string `yaml:"state_file"`
+}
+
+// Cluster configures clustered mode.
+type Cluster struct {
+
+	// ID is the raft ID of this node, setting it enables clustered mode.
+	ID string `yaml:"id"`
+
+	// Peers lists all cluster members as id@raft-address@grpc-address, including this node.
+	Peers []string `yaml:"peers"`
+
+	// Dir is the directory to store the raft log and stable store (raft.db) and raft snapshots in.
+	Dir string `yaml:"dir"`
+
+	// Token is the bearer token used to forward commands to the leader.
+	Token string `yaml:"token"`
+
+	// Secret is shared by all cluster nodes, the ClusterService only accepts commands carrying it.
+	Secret string `yaml:"secret"`
+}
+
+// TLS configures transport security.
+type TLS struct {
+
+	// Cert is the PEM certificate file to serve TLS with.
+	Cert string `yaml:"cert"`
+
+	// Key is the PEM key file of the certificate.
+	Key string `yaml:"key"`
+
+	// CA is the PEM CA file to verify client certificates with.
+	CA string `yaml:"ca"`
+
+	// RequireClientCert rejects clients without a certificate signed by CA.
+	RequireClientCert bool `yaml:"require_client_cert"`
+}
+
+// Auth configures authentication, access control and force tokens.
+type Auth struct {
+
+	// TokenFile maps bearer tokens to principals and enables authentication.
+	TokenFile string `yaml:"token_file"`
+
+	// ACLFile holds the access control rules.
+	ACLFile string `yaml:"acl_file"`
+
+	// ForceToken is a plain or hashed token accepted for forced releases and snapshots.
+	ForceToken string `yaml:"force_token"`
+
+	// ForceTokenFile lists plain or hashed tokens accepted for forced releases and snapshots.
+	ForceTokenFile string `yaml:"force_token_file"`
+}
+
+// Metrics configures the Prometheus metrics listener.
+type Metrics struct {
+
+	// Listen is the host:port to serve metrics on at /metrics.
+	Listen string `yaml:"listen"`
+}
+
+// HTTP configures the HTTP/JSON gateway.
+type HTTP struct {
+
+	// Listen is the host:port to serve the HTTP/JSON gateway on.
+	Listen string `yaml:"listen"`
+
+	// Dashboard serves the web dashboard at /ui/ of the HTTP gateway.
+	Dashboard bool `yaml:"dashboard"`
+}
+
+// Tracing configures the OpenTelemetry trace exporter.
+type Tracing struct {
+
+	// Exporter is none, otlp or stdout.
+	Exporter string `yaml:"exporter"`
+
+	// Endpoint is the host:port of the OTLP collector.
+	Endpoint string `yaml:"endpoint"`
+
+	// Insecure connects to the OTLP collector without TLS.
+	Insecure bool `yaml:"insecure"`
+
+	// File is the file the stdout exporter appends spans to.
+	File string `yaml:"file"`
+}
+
+// Audit configures the audit log of privileged operations.
+type Audit struct {
+
+	// File is the file audit entries are appended to as JSON lines.
+	File string `yaml:"file"`
+
+	// MaxSizeMB is the size in megabytes the file is rotated at.
+	MaxSizeMB int `yaml:"max_size_mb"`
+
+	// MaxBackups is the number of rotated files to keep, 0 keeps all.
+	MaxBackups int `yaml:"max_backups"`
+}
+
+// Limits configures quotas, 0 disables a limit.
+type Limits struct {
+
+	// MaxLocksPerClient is the maximum number of locks a client principal may hold.
+	MaxLocksPerClient int `yaml:"max_locks_per_client"`
+
+	// MaxLocksPerNamespace is the maximum number of locks held in a namespace.
+	MaxLocksPerNamespace int `yaml:"max_locks_per_namespace"`
+
+	// MaxWaitersPerClient is the maximum number of waiting lock requests of a client principal.
+	MaxWaitersPerClient int `yaml:"max_waiters_per_client"`
+
+	// MaxWaitersPerNamespace is the maximum number of waiting lock requests in a namespace.
+	MaxWaitersPerNamespace int `yaml:"max_waiters_per_namespace"`
+}
+
+// Quota returns the limits as quota.Limits.
+func (l Limits) Quota() quota.Limits {
+	return quota.Limits{
+		HeldPerClient:       l.MaxLocksPerClient,
+		HeldPerNamespace:    l.MaxLocksPerNamespace,
+		WaitingPerClient:    l.MaxWaitersPerClient,
+		WaitingPerNamespace: l.MaxWaitersPerNamespace,
+	}
+}
+
+// Policy restricts lock requests for locks matching a namespace and name pattern.
+type Policy struct {
+
+	// Namespace is the namespace pattern, empty for all namespaces.
+	Namespace string `yaml:"namespace"`
+
+	// Pattern is the lock name pattern, * matches any sequence of characters and ? a single character.
+	Pattern string `yaml:"pattern"`
+
+	// MaxTimeoutSeconds caps the wait timeout of lock requests, 0 for no cap.
+	MaxTimeoutSeconds int32 `yaml:"max_timeout_seconds"`
+
+	// Frozen rejects new lock requests, held locks can still be released.
+	Frozen bool `yaml:"frozen"`
+}
+
+// Policy returns the policy as policy.Policy.
+func (p Policy) Policy() policy.Policy {
+	return policy.Policy{Namespace: p.Namespace, Pattern: p.Pattern, MaxTimeoutSeconds: p.MaxTimeoutSeconds, Frozen: p.Frozen}
+}
+
+// Load reads and validates a YAML configuration file. Unknown keys are rejected.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, describe(data, err))
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration, every error names the offending key.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Log.Level != "" {
+		if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+			invalid("log.level", "%v", err)
+		}
+	}
+	switch c.Log.Format {
+	case "", logging.FormatText, logging.FormatJSON:
+	default:
+		invalid("log.format", "unknown log format %q, expected text or json", c.Log.Format)
+	}
+
+	if c.Listen.Port < 0 || c.Listen.Port > 65535 {
+		invalid("listen.port", "%d is not a valid port", c.Listen.Port)
+	}
+	if c.Listen.SocketMode != "" {
+		if _, err := strconv.ParseUint(c.Listen.SocketMode, 8, 32); err != nil {
+			invalid("listen.socket_mode", "%q is not an octal file mode", c.Listen.SocketMode)
+		}
+	}
+
+	switch c.Backend.Type {
+	case "", "inmemory", "sharded":
+	default:
+		invalid("backend.type", "unknown backend %q, expected inmemory or sharded", c.Backend.Type)
+	}
+	if c.Backend.Shards < 0 {
+		invalid("backend.shards", "must not be negative")
+	}
+	if c.Backend.HistorySize < 0 {
+		invalid("backend.history_size", "must not be negative")
+	}
+
+	if c.Cluster.ID != "" {
+		if len(c.Cluster.Peers) == 0 {
+			invalid("cluster.peers", "required when cluster.id is set")
+		}
+		if c.Cluster.Secret == "" {
+			invalid("cluster.secret", "required when cluster.id is set")
+		}
+		if c.Backend.StateFile != "" {
+			invalid("backend.state_file", "not supported in clustered mode, use cluster.dir")
+		}
+	}
+	member := false
+	for i, entry := range c.Cluster.Peers {
+		peers, err := cluster.ParsePeers(entry)
+		if err != nil {
+			invalid(fmt.Sprintf("cluster.peers[%d]", i), "%v", err)
+			continue
+		}
+		for _, p := range peers {
+			member = member || p.ID == c.Cluster.ID
+		}
+	}
+	if c.Cluster.ID != "" && len(c.Cluster.Peers) > 0 && !member {
+		invalid("cluster.id", "%q is not listed in cluster.peers", c.Cluster.ID)
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		invalid("tls.key", "tls.cert and tls.key must be set together")
+	}
+	if c.TLS.CA != "" && c.TLS.Cert == "" {
+		invalid("tls.ca", "requires tls.cert and tls.key")
+	}
+	if c.TLS.RequireClientCert && c.TLS.CA == "" {
+		invalid("tls.require_client_cert", "requires tls.ca")
+	}
+
+	if c.Auth.ACLFile != "" && c.Auth.TokenFile == "" {
+		invalid("auth.acl_file", "requires auth.token_file")
+	}
+
+	limits := []struct {
+		key   string
+		value int
+	}{
+		{"limits.max_locks_per_client", c.Limits.MaxLocksPerClient},
+		{"limits.max_locks_per_namespace", c.Limits.MaxLocksPerNamespace},
+		{"limits.max_waiters_per_client", c.Limits.MaxWaitersPerClient},
+		{"limits.max_waiters_per_namespace", c.Limits.MaxWaitersPerNamespace},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			invalid(limit.key, "must not be negative")
+		}
+	}
+
+	for i, p := range c.Policies {
+		if p.Pattern == "" {
+			invalid(fmt.Sprintf("policies[%d].pattern", i), "required")
+		}
+		if p.MaxTimeoutSeconds < 0 {
+			invalid(fmt.Sprintf("policies[%d].max_timeout_seconds", i), "must not be negative")
+		}
+	}
+
+	if c.HTTP.Dashboard && c.HTTP.Listen == "" {
+		invalid("http.dashboard", "requires http.listen")
+	}
+
+	switch c.Tracing.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		invalid("tracing.exporter", "unknown trace exporter %q, expected none, otlp or stdout", c.Tracing.Exporter)
+	}
+	if c.Tracing.Endpoint != "" && c.Tracing.Exporter != tracing.ExporterOTLP {
+		invalid("tracing.endpoint", "requires tracing.exporter otlp")
+	}
+	if c.Tracing.Insecure && c.Tracing.Exporter != tracing.ExporterOTLP {
+		invalid("tracing.insecure", "requires tracing.exporter otlp")
+	}
+	if c.Tracing.File != "" && c.Tracing.Exporter != tracing.ExporterStdout {
+		invalid("tracing.file", "requires tracing.exporter stdout")
+	}
+
+	if c.Audit.MaxSizeMB < 0 {
+		invalid("audit.max_size_mb", "must not be negative")
+	}
+	if c.Audit.MaxBackups < 0 {
+		invalid("audit.max_backups", "must not be negative")
+	}
+
+	if c.ShutdownTimeout != "" {
+		if d, err := time.ParseDuration(c.ShutdownTimeout); err != nil || d <= 0 {
+			invalid("shutdown_timeout", "%q is not a positive duration", c.ShutdownTimeout)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describe prefixes the messages of a YAML type error with the key found at the reported line.
+func describe(data []byte, err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil {
+		return err
+	}
+	errs := make([]error, 0, len(typeErr.Errors))
+	for _, message := range typeErr.Errors {
+		var line int
+		if _, scanErr := fmt.Sscanf(message, "line %d:", &line); scanErr == nil {
+			collection := strings.Contains(message, "!!map") || strings.Contains(message, "!!seq")
+			if key := keyAt(&root, line, "", collection); key != "" {
+				_, detail, _ := strings.Cut(message, ": ")
+				message = key + ": " + detail
+			}
+		}
+		errs = append(errs, errors.New(message))
+	}
+	return errors.Join(errs...)
+}
+
+// keyAt returns the dotted path of the key defined on line, empty if there is none. With collection set the error
+// is about a mapping or sequence starting on line, which is reported as the key holding it.
+func keyAt(node *yaml.Node, line int, prefix string, collection bool) string {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for i, child := range node.Content {
+			childPrefix := prefix
+			if node.Kind == yaml.SequenceNode {
+				childPrefix = fmt.Sprintf("%s[%d]", prefix, i)
+				if child.Line == line && (child.Kind != yaml.MappingNode || collection) {
+					return childPrefix
+				}
+			}
+			if key := keyAt(child, line, childPrefix, collection); key != "" {
+				return key
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			if node.Content[i].Line == line && node.Content[i+1].Kind == yaml.ScalarNode {
+				return name
+			}
+			if collection && node.Content[i+1].Line == line && node.Content[i+1].Kind != yaml.ScalarNode {
+				return name
+			}
+			if key := keyAt(node.Content[i+1], line, name, collection); key != "" {
+				return key
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// load writes content to a config file and loads it.
+func load(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lockd.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	return Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := load(t, "listen:\n  port: 7000\nlimits:\n  max_locks_per_client: 3\npolicies:\n  - pattern: db-*\n    frozen: true\n")
+	if err != nil {
+		t.Fatalf("loading valid config: %v", err)
+	}
+	if cfg.Listen.Port != 7000 || cfg.Limits.MaxLocksPerClient != 3 || len(cfg.Policies) != 1 || !cfg.Policies[0].Frozen {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content string
+		key     string
+	}{
+		"unknown top level key":   {"verbos: true\n", "verbos"},
+		"unknown nested key":      {"listen:\n  prot: 7000\n", "listen.prot"},
+		"unknown policy key":      {"policies:\n  - pattern: db\n    freeze: true\n", "policies[0].freeze"},
+		"port not a number":       {"listen:\n  port: seventy\n", "listen.port"},
+		"limit not a number":      {"limits:\n  max_locks_per_client: many\n", "limits.max_locks_per_client"},
+		"verbose not a bool":      {"verbose: sometimes\n", "verbose"},
+		"peers not a list":        {"cluster:\n  peers:\n    id: n1\n", "cluster.peers"},
+		"policies not a list":     {"policies:\n  pattern: db\n", "policies"},
+		"listen not a mapping":    {"listen: 7000\n", "listen"},
+		"policy timeout bad type": {"policies:\n  - pattern: db\n    max_timeout_seconds: long\n", "policies[0].max_timeout_seconds"},
+		"log level":               {"log:\n  level: loud\n", "log.level"},
+		"port out of range":       {"listen:\n  port: 70000\n", "listen.port"},
+		"negative limit":          {"limits:\n  max_waiters_per_namespace: -1\n", "limits.max_waiters_per_namespace"},
+		"backend type":            {"backend:\n  type: disk\n", "backend.type"},
+		"policy without pattern":  {"policies:\n  - frozen: true\n", "policies[0].pattern"},
+		"invalid peer":            {"cluster:\n  id: n1\n  secret: s\n  peers:\n    - n1@only\n", "cluster.peers[0]"},
+		"shutdown timeout":        {"shutdown_timeout: soon\n", "shutdown_timeout"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(t, tc.content)
+			if err == nil {
+				t.Fatalf("expected an error for key %s", tc.key)
+			}
+			if !strings.Contains(err.Error(), tc.key+":") && !strings.Contains(err.Error(), tc.key+" ") {
+				t.Errorf("expected the error to name %s, got %v", tc.key, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config Config
+		key    string
+	}{
+		"log format":           {Config{Log: Log{Format: "xml"}}, "log.format"},
+		"socket mode":          {Config{Listen: Listen{SocketMode: "rw"}}, "listen.socket_mode"},
+		"negative shards":      {Config{Backend: Backend{Shards: -1}}, "backend.shards"},
+		"cluster without peer": {Config{Cluster: Cluster{ID: "n1", Secret: "s"}}, "cluster.peers"},
+		"cluster without key":  {Config{Cluster: Cluster{ID: "n1", Peers: []string{"n1@a@b"}}}, "cluster.secret"},
+		"id not a peer":        {Config{Cluster: Cluster{ID: "n2", Secret: "s", Peers: []string{"n1@a@b"}}}, "cluster.id"},
+		"tls key without cert": {Config{TLS: TLS{Key: "key.pem"}}, "tls.key"},
+		"acl without tokens":   {Config{Auth: Auth{ACLFile: "acl.yaml"}}, "auth.acl_file"},
+		"dashboard":            {Config{HTTP: HTTP{Dashboard: true}}, "http.dashboard"},
+		"trace exporter":       {Config{Tracing: Tracing{Exporter: "zipkin"}}, "tracing.exporter"},
+		"negative policy":      {Config{Policies: []Policy{{Pattern: "a"}, {Pattern: "b", MaxTimeoutSeconds: -1}}}, "policies[1].max_timeout_seconds"},
+		"audit backups":        {Config{Audit: Audit{MaxBackups: -1}}, "audit.max_backups"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if err == nil || !strings.HasPrefix(err.Error(), tc.key+":") {
+				t.Errorf("expected an error for %s, got %v", tc.key, err)
+			}
+		})
+	}
+	if err := (&Config{}).Validate(); err != nil {
+		t.Errorf("expected an empty config to be valid, got %v", err)
+	}
+}
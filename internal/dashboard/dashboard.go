@@ -0,0 +1,22 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// static holds the HTML, JavaScript and CSS of the dashboard.
+//
+//go:embed static
+var static embed.FS
+
+// Handler returns the HTTP handler serving the dashboard. The dashboard is a static page using the HTTP/JSON gateway
+// mounted at /v1/ of the same server, so it has to be served next to it.
+func Handler() (http.Handler, error) {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		return nil, err
+	}
+	return http.FileServerFS(files), nil
+}
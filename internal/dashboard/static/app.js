@@ -0,0 +1,275 @@
+// lockd dashboard: shows the locks and recent events using the HTTP/JSON gateway and follows /v1/watch for
+// live updates. The bearer token is kept in the session storage of the browser only.
+"use strict";
+
+const api = "../v1/";
+const maxEvents = 200;
+
+const state = {
+  namespace: sessionStorage.getItem("namespace") || "",
+  allNamespaces: sessionStorage.getItem("allNamespaces") === "true",
+  token: sessionStorage.getItem("token") || "",
+  locks: [],
+  events: [],
+  watch: null,
+  refreshTimer: null,
+};
+
+const $ = (id) => document.getElementById(id);
+
+// request calls the gateway and returns the decoded JSON response, throwing the status message on errors.
+async function request(path, options = {}) {
+  const headers = Object.assign({"Accept": "application/json"}, options.headers || {});
+  if (state.token) {
+    headers["Authorization"] = "Bearer " + state.token;
+  }
+  const response = await fetch(api + path, Object.assign({}, options, {headers}));
+  const body = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new Error(body.message || response.statusText);
+  }
+  return body;
+}
+
+// lockPath returns the API path of an action on a lock. The name is escaped as a whole, so slashes and dot
+// segments in it reach lockd unchanged instead of being resolved by the browser.
+function lockPath(name, action) {
+  return "locks/" + encodeURIComponent(name) + "/" + action;
+}
+
+// query returns the namespace query parameters of the current selection.
+function query() {
+  const params = new URLSearchParams();
+  if (state.allNamespaces) {
+    params.set("all_namespaces", "true");
+  } else if (state.namespace) {
+    params.set("namespace", state.namespace);
+  }
+  return params;
+}
+
+function showMessage(text) {
+  $("message").textContent = text;
+  $("message").hidden = !text;
+}
+
+function setStatus(text, className) {
+  $("status").textContent = text;
+  $("status").className = "status " + (className || "");
+}
+
+// since formats the time passed since an RFC 3339 timestamp.
+function since(timestamp) {
+  if (!timestamp) {
+    return "";
+  }
+  const seconds = Math.max(0, Math.round((Date.now() - Date.parse(timestamp)) / 1000));
+  if (seconds < 60) {
+    return seconds + "s";
+  }
+  if (seconds < 3600) {
+    return Math.floor(seconds / 60) + "m " + (seconds % 60) + "s";
+  }
+  return Math.floor(seconds / 3600) + "h " + Math.floor((seconds % 3600) / 60) + "m";
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function renderLocks() {
+  const body = $("locks");
+  body.replaceChildren();
+  for (const lock of state.locks) {
+    const row = body.insertRow();
+    cell(row, lock.namespace);
+    cell(row, lock.name);
+    if (lock.locked) {
+      cell(row, "pid " + lock.pid + " on " + lock.addr);
+      cell(row, since(lock.since));
+    } else {
+      cell(row, "free", "free");
+      cell(row, "");
+    }
+    const waiting = cell(row, "");
+    if (lock.waiters.length > 0) {
+      const list = document.createElement("ul");
+      for (const waiter of lock.waiters) {
+        const item = document.createElement("li");
+        item.textContent = "pid " + waiter.pid + " on " + waiter.addr + " for " + since(waiter.since);
+        list.appendChild(item);
+      }
+      waiting.appendChild(list);
+    }
+    const action = cell(row, "");
+    if (lock.locked) {
+      const button = document.createElement("button");
+      button.className = "force";
+      button.textContent = "Force release";
+      button.addEventListener("click", () => forceRelease(lock));
+      action.appendChild(button);
+    }
+  }
+  $("no-locks").hidden = state.locks.length > 0;
+}
+
+function renderEvents() {
+  const body = $("events");
+  body.replaceChildren();
+  for (const event of state.events) {
+    const row = body.insertRow();
+    cell(row, new Date(event.time).toLocaleString());
+    cell(row, event.namespace);
+    cell(row, event.lock_name);
+    cell(row, event.type);
+    cell(row, "pid " + event.pid + " on " + event.addr);
+    cell(row, event.type === "queued" ? "" : event.duration);
+  }
+  $("no-events").hidden = state.events.length > 0;
+  $("history-note").hidden = !state.allNamespaces;
+}
+
+async function loadLocks() {
+  const response = await request("locks?" + query());
+  state.locks = response.locks.sort((a, b) => (a.namespace + "/" + a.name).localeCompare(b.namespace + "/" + b.name));
+  renderLocks();
+}
+
+async function loadHistory() {
+  state.events = [];
+  if (!state.allNamespaces) {
+    const response = await request("history?" + query());
+    state.events = response.events.reverse().slice(0, maxEvents);
+  }
+  renderEvents();
+}
+
+// scheduleRefresh reloads the locks shortly after events arrived, coalescing bursts of events.
+function scheduleRefresh() {
+  if (state.refreshTimer) {
+    return;
+  }
+  state.refreshTimer = setTimeout(() => {
+    state.refreshTimer = null;
+    loadLocks().catch((error) => showMessage(error.message));
+  }, 200);
+}
+
+// watch follows the server-sent events of /v1/watch. fetch is used instead of EventSource to send the token.
+async function watch(controller) {
+  const headers = {"Accept": "text/event-stream"};
+  if (state.token) {
+    headers["Authorization"] = "Bearer " + state.token;
+  }
+  const response = await fetch(api + "watch?" + query(), {headers, signal: controller.signal});
+  if (!response.ok) {
+    const body = await response.json().catch(() => ({}));
+    throw new Error(body.message || response.statusText);
+  }
+  setStatus("live", "live");
+  // reload once the watch is established so no change in between is missed
+  await Promise.all([loadLocks(), loadHistory()]);
+  const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = "";
+  for (;;) {
+    const {value, done} = await reader.read();
+    if (done) {
+      throw new Error("stream ended");
+    }
+    buffer += value;
+    let end;
+    while ((end = buffer.indexOf("\n\n")) >= 0) {
+      handleMessage(buffer.slice(0, end));
+      buffer = buffer.slice(end + 2);
+    }
+  }
+}
+
+function handleMessage(message) {
+  let type = "message";
+  let data = "";
+  for (const line of message.split("\n")) {
+    if (line.startsWith("event: ")) {
+      type = line.slice(7);
+    } else if (line.startsWith("data: ")) {
+      data += line.slice(6);
+    }
+  }
+  const payload = JSON.parse(data);
+  if (type === "error") {
+    throw new Error(payload.message);
+  }
+  // events recorded while the history was loaded are part of it already
+  const key = (e) => [e.time, e.type, e.namespace, e.lock_name, e.pid, e.addr].join("|");
+  if (state.events.some((e) => key(e) === key(payload))) {
+    return;
+  }
+  state.events.unshift(payload);
+  state.events.length = Math.min(state.events.length, maxEvents);
+  renderEvents();
+  scheduleRefresh();
+}
+
+// connect (re)starts watching, retrying after failures.
+function connect() {
+  if (state.watch) {
+    state.watch.abort();
+  }
+  const controller = new AbortController();
+  state.watch = controller;
+  watch(controller).catch((error) => {
+    if (controller.signal.aborted) {
+      return;
+    }
+    setStatus("disconnected", "error");
+    showMessage(error.message);
+    setTimeout(() => {
+      if (state.watch === controller) {
+        connect();
+      }
+    }, 3000);
+  });
+}
+
+async function forceRelease(lock) {
+  const token = prompt("Force token to release " + lock.namespace + "/" + lock.name);
+  if (!token) {
+    return;
+  }
+  try {
+    const response = await request(lockPath(lock.name, "release"), {
+      method: "POST",
+      headers: {"Content-Type": "application/json"},
+      body: JSON.stringify({namespace: lock.namespace, force_token: token}),
+    });
+    showMessage(response.success ? "" : response.message);
+    await loadLocks();
+  } catch (error) {
+    showMessage(error.message);
+  }
+}
+
+$("settings").addEventListener("submit", (event) => {
+  event.preventDefault();
+  state.namespace = $("namespace").value.trim();
+  state.allNamespaces = $("all-namespaces").checked;
+  state.token = $("token").value;
+  sessionStorage.setItem("namespace", state.namespace);
+  sessionStorage.setItem("allNamespaces", String(state.allNamespaces));
+  sessionStorage.setItem("token", state.token);
+  showMessage("");
+  setStatus("connecting");
+  connect();
+});
+
+$("namespace").value = state.namespace;
+$("all-namespaces").checked = state.allNamespaces;
+$("token").value = state.token;
+// keep the durations current between events
+setInterval(renderLocks, 1000);
+connect();
@@ -0,0 +1,190 @@
+package lockmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/inmemory"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/sharded"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// acquirers are the minimum numbers of concurrent acquirers the benchmarks run with, 1 runs one per GOMAXPROCS.
+var acquirers = []int{1, 4096}
+
+// newBackends create the lockers the tests and benchmarks run against.
+var newBackends = map[string]func() backend{
+	"inmemory": func() backend { return inmemory.NewInMemoryLocker() },
+	"sharded":  func() backend { return sharded.NewShardedLocker(sharded.DefaultShards) },
+}
+
+// backend is a locker able to restore its state.
+type backend interface {
+	types.Locker
+	types.Restorer
+}
+
+// lockNames returns names distinct lock names.
+func lockNames(names int) []string {
+	lockNames := make([]string, names)
+	for i := range lockNames {
+		lockNames[i] = fmt.Sprintf("lock-%d", i)
+	}
+	return lockNames
+}
+
+// benchmarkLocker lets parallel acquirers lock and unlock random locks out of names on locker. Attempts on a lock
+// held by another acquirer count as busy. parallelism is the minimum number of acquirers, it is rounded up to a
+// multiple of GOMAXPROCS.
+func benchmarkLocker(b *testing.B, locker types.Locker, names, parallelism int) {
+	ctx := context.Background()
+	lockNames := lockNames(names)
+	var pids, busy atomic.Int32
+	procs := runtime.GOMAXPROCS(0)
+	b.SetParallelism((parallelism + procs - 1) / procs)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		pid := pids.Add(1)
+		rnd := rand.New(rand.NewSource(int64(pid)))
+		for pb.Next() {
+			name := lockNames[rnd.Intn(len(lockNames))]
+			if err := locker.Lock(ctx, types.DefaultNamespace, name, pid, "bench"); err != nil {
+				busy.Add(1)
+				continue
+			}
+			_ = locker.Unlock(ctx, types.DefaultNamespace, name, pid, "bench")
+		}
+	})
+	b.ReportMetric(float64(busy.Load())/float64(b.N), "busy/op")
+}
+
+// benchmarkGetLocks lets parallel acquirers lock and unlock their own lock on locker, which holds names further
+// locks. Every listEvery-th operation copies the state using GetLocks instead.
+func benchmarkGetLocks(b *testing.B, locker types.Locker, names, parallelism int) {
+	const listEvery = 100
+	ctx := context.Background()
+	for _, name := range lockNames(names) {
+		if err := locker.Lock(ctx, types.DefaultNamespace, name, 1, "held"); err != nil {
+			b.Fatalf("locking %s: %v", name, err)
+		}
+	}
+	var pids, ops atomic.Int32
+	procs := runtime.GOMAXPROCS(0)
+	b.SetParallelism((parallelism + procs - 1) / procs)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		pid := pids.Add(1) + 1
+		name := fmt.Sprintf("busy-%d", pid)
+		for pb.Next() {
+			if ops.Add(1)%listEvery == 0 {
+				if held := len(locker.GetLocks(ctx)); held < names {
+					b.Errorf("expected at least %d locks, got %d", names, held)
+				}
+				continue
+			}
+			if locker.Lock(ctx, types.DefaultNamespace, name, pid, "bench") == nil {
+				_ = locker.Unlock(ctx, types.DefaultNamespace, name, pid, "bench")
+			}
+		}
+	})
+}
+
+// benchmarkBackend runs benchmarkLocker with few and many lock names and acquirers as well as benchmarkGetLocks on
+// lockers created by newLocker.
+func benchmarkBackend(b *testing.B, newLocker func() backend) {
+	for _, names := range []int{10, 10000} {
+		for _, parallelism := range acquirers {
+			b.Run(fmt.Sprintf("names=%d/acquirers=%d", names, parallelism), func(b *testing.B) {
+				benchmarkLocker(b, newLocker(), names, parallelism)
+			})
+		}
+	}
+	for _, parallelism := range acquirers {
+		b.Run(fmt.Sprintf("GetLocks/names=10000/acquirers=%d", parallelism), func(b *testing.B) {
+			benchmarkGetLocks(b, newLocker(), 10000, parallelism)
+		})
+	}
+}
+
+func BenchmarkInMemoryLocker(b *testing.B) {
+	benchmarkBackend(b, newBackends["inmemory"])
+}
+
+func BenchmarkShardedLocker(b *testing.B) {
+	benchmarkBackend(b, newBackends["sharded"])
+}
+
+func TestBackendLockUnlock(t *testing.T) {
+	ctx := context.Background()
+	for name, newLocker := range newBackends {
+		t.Run(name, func(t *testing.T) {
+			locker := newLocker()
+			for _, lock := range lockNames(100) {
+				if err := locker.Lock(ctx, types.DefaultNamespace, lock, 1, "a"); err != nil {
+					t.Fatalf("locking %s: %v", lock, err)
+				}
+				if err := locker.Lock(ctx, types.DefaultNamespace, lock, 2, "b"); !errors.Is(err, types.ErrLockExists) {
+					t.Fatalf("locking held %s: expected %v, got %v", lock, types.ErrLockExists, err)
+				}
+				// the same name in another namespace is a different lock
+				if err := locker.Lock(ctx, "other", lock, 2, "b"); err != nil {
+					t.Fatalf("locking %s in other namespace: %v", lock, err)
+				}
+				if err := locker.Unlock(ctx, types.DefaultNamespace, lock, 2, "b"); !errors.Is(err, types.ErrStrangersLock) {
+					t.Fatalf("unlocking %s as stranger: expected %v, got %v", lock, types.ErrStrangersLock, err)
+				}
+			}
+			if held := len(locker.GetLocks(ctx)); held != 200 {
+				t.Fatalf("expected 200 locks, got %d", held)
+			}
+			for _, lock := range lockNames(100) {
+				if err := locker.Unlock(ctx, types.DefaultNamespace, lock, 1, "a"); err != nil {
+					t.Fatalf("unlocking %s: %v", lock, err)
+				}
+				if err := locker.UnlockByName(ctx, "other", lock); err != nil {
+					t.Fatalf("unlocking %s by name: %v", lock, err)
+				}
+			}
+			if held := len(locker.GetLocks(ctx)); held != 0 {
+				t.Fatalf("expected no locks, got %d", held)
+			}
+		})
+	}
+}
+
+func TestBackendRestore(t *testing.T) {
+	ctx := context.Background()
+	for name, newLocker := range newBackends {
+		t.Run(name, func(t *testing.T) {
+			locker := newLocker()
+			if err := locker.Lock(ctx, types.DefaultNamespace, "stale", 1, "a"); err != nil {
+				t.Fatalf("locking: %v", err)
+			}
+			restored := make([]types.LockInfo, 0)
+			for i, lock := range lockNames(100) {
+				restored = append(restored, types.LockInfo{Namespace: types.DefaultNamespace, Name: lock, Pid: int32(i), Addr: "b", IsLocked: true})
+			}
+			if err := locker.Restore(ctx, restored); err != nil {
+				t.Fatalf("restoring: %v", err)
+			}
+			locks := locker.GetLocks(ctx)
+			sort.Slice(locks, func(i, j int) bool { return locks[i].Pid < locks[j].Pid })
+			if !reflect.DeepEqual(locks, restored) {
+				t.Fatalf("expected the restored locks to replace the state, got %+v", locks)
+			}
+			if err := locker.Lock(ctx, types.DefaultNamespace, "lock-7", 1, "a"); !errors.Is(err, types.ErrLockExists) {
+				t.Errorf("locking restored lock: expected %v, got %v", types.ErrLockExists, err)
+			}
+			if err := locker.Unlock(ctx, types.DefaultNamespace, "lock-7", 7, "b"); err != nil {
+				t.Errorf("unlocking restored lock as its holder: %v", err)
+			}
+		})
+	}
+}
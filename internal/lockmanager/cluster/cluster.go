@@ -0,0 +1,382 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/sascha-andres/lockutil/internal/auth"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+	"github.com/sascha-andres/lockutil/internal/tracing"
+)
+
+// applyTimeout is the maximum time to wait for a command to be committed or forwarded.
+const applyTimeout = 10 * time.Second
+
+// ErrNoSecret is returned by NewNode when no cluster secret is configured.
+var ErrNoSecret = errors.New("cluster secret is required")
+
+// ErrNoLeader is returned when a command cannot be applied because the cluster has no known leader.
+var ErrNoLeader = errors.New("cluster has no leader")
+
+// Peer describes a member of the lockd cluster.
+type Peer struct {
+
+	// ID is the unique raft server ID of the node.
+	ID string
+
+	// RaftAddr is the address the node uses for raft traffic.
+	RaftAddr string
+
+	// GRPCAddr is the address of the lockd gRPC service of the node, used to forward commands to the leader.
+	GRPCAddr string
+}
+
+// Config holds the settings to start a cluster node.
+type Config struct {
+
+	// ID is the raft server ID of this node, it must be listed in Peers.
+	ID string
+
+	// Peers lists all members of the cluster including this node.
+	Peers []Peer
+
+	// DataDir is the directory used to keep the raft log, the current term and vote and raft snapshots, empty to
+	// keep them in memory. A node keeping its state in memory must not rejoin the cluster after a restart as a
+	// member that already voted.
+	DataDir string
+
+	// Transport overrides the raft transport, a TCP transport bound to the RaftAddr of this node is used when nil.
+	// Use raft.NewInmemTransport to run several nodes within one process.
+	Transport raft.Transport
+
+	// Credentials are used to connect to the ClusterService of the leader, nil for an unencrypted connection.
+	Credentials credentials.TransportCredentials
+
+	// Token is sent as bearer token when forwarding commands, empty to not authenticate.
+	Token string
+
+	// Secret is shared by all nodes of the cluster and sent when forwarding commands. The ClusterService only
+	// accepts commands carrying it, see VerifySecret. It is required.
+	Secret string
+
+	// Logger receives the log records of raft, slog.Default() when nil. Raft records below warn level are
+	// written at debug level.
+	Logger *slog.Logger
+
+	// TracerProvider creates the client spans of commands forwarded to the leader, nil to use the global provider.
+	// The trace context is passed to the leader in any case.
+	TracerProvider trace.TracerProvider
+}
+
+// Node is a member of a raft cluster replicating lock state. It implements types.Locker.
+// State changes are applied on the leader, followers forward them using the ClusterService.
+type Node struct {
+	raft   *raft.Raft
+	fsm    *fsm
+	peers  map[raft.ServerID]Peer
+	creds  credentials.TransportCredentials
+	token  string
+	secret string
+	trace  []otelgrpc.Option
+	logger *slog.Logger
+
+	// store keeps the raft log and stable state in DataDir, nil when kept in memory.
+	store *raftboltdb.BoltStore
+
+	mu      sync.Mutex
+	clients map[string]*grpc.ClientConn
+}
+
+// ParsePeers parses a comma separated list of peers in the form id@raft-address@grpc-address.
+func ParsePeers(value string) ([]Peer, error) {
+	peers := make([]Peer, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "@")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid peer %q, expected id@raft-address@grpc-address", entry)
+		}
+		peers = append(peers, Peer{ID: parts[0], RaftAddr: parts[1], GRPCAddr: parts[2]})
+	}
+	return peers, nil
+}
+
+// NewNode starts a raft node for the given configuration and bootstraps the cluster from the configured peers.
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.Secret == "" {
+		return nil, ErrNoSecret
+	}
+	n := &Node{
+		fsm:     newFSM(),
+		peers:   make(map[raft.ServerID]Peer),
+		clients: make(map[string]*grpc.ClientConn),
+		creds:   cfg.Credentials,
+		token:   cfg.Token,
+		secret:  cfg.Secret,
+		trace:   []otelgrpc.Option{otelgrpc.WithPropagators(tracing.Propagator)},
+	}
+	if cfg.TracerProvider != nil {
+		n.trace = append(n.trace, otelgrpc.WithTracerProvider(cfg.TracerProvider))
+	}
+	if n.creds == nil {
+		n.creds = insecure.NewCredentials()
+	}
+	var self *Peer
+	servers := make([]raft.Server, 0, len(cfg.Peers))
+	for i := range cfg.Peers {
+		p := cfg.Peers[i]
+		n.peers[raft.ServerID(p.ID)] = p
+		servers = append(servers, raft.Server{ID: raft.ServerID(p.ID), Address: raft.ServerAddress(p.RaftAddr)})
+		if p.ID == cfg.ID {
+			self = &p
+		}
+	}
+	if self == nil {
+		return nil, fmt.Errorf("node %q is not part of the configured peers", cfg.ID)
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	n.logger = logger
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.Logger = newRaftLogger(logger)
+
+	transport := cfg.Transport
+	if transport == nil {
+		addr, err := net.ResolveTCPAddr("tcp", self.RaftAddr)
+		if err != nil {
+			return nil, err
+		}
+		transport, err = raft.NewTCPTransportWithLogger(self.RaftAddr, addr, 3, applyTimeout, conf.Logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var snapshots raft.SnapshotStore = raft.NewInmemSnapshotStore()
+	if cfg.DataDir != "" {
+		fss, err := raft.NewFileSnapshotStoreWithLogger(cfg.DataDir, 2, conf.Logger)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = fss
+	}
+	var logs raft.LogStore
+	var stable raft.StableStore
+	if cfg.DataDir != "" {
+		store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft.db"))
+		if err != nil {
+			return nil, err
+		}
+		n.store = store
+		logs, stable = store, store
+	} else {
+		store := raft.NewInmemStore()
+		logs, stable = store, store
+	}
+
+	r, err := raft.NewRaft(conf, n.fsm, logs, stable, snapshots, transport)
+	if err != nil {
+		n.closeStore()
+		return nil, err
+	}
+	n.raft = r
+
+	// every node bootstraps with the same configuration, raft ignores this once a node has state
+	err = r.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+	if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+		_ = n.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Close shuts down the raft node and closes connections to other nodes.
+func (n *Node) Close() error {
+	n.mu.Lock()
+	for _, conn := range n.clients {
+		_ = conn.Close()
+	}
+	n.clients = make(map[string]*grpc.ClientConn)
+	n.mu.Unlock()
+	err := n.raft.Shutdown().Error()
+	return errors.Join(err, n.closeStore())
+}
+
+// closeStore closes the durable raft store, if any.
+func (n *Node) closeStore() error {
+	if n.store == nil {
+		return nil
+	}
+	return n.store.Close()
+}
+
+// Snapshot persists the replicated state to the snapshot store, e.g. before shutting down.
+func (n *Node) Snapshot() error {
+	err := n.raft.Snapshot().Error()
+	if errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return nil
+	}
+	return err
+}
+
+// IsLeader reports whether this node is the current raft leader.
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Leader returns the ID of the current leader, empty when no leader is known.
+func (n *Node) Leader() string {
+	_, id := n.raft.LeaderWithID()
+	return string(id)
+}
+
+// Lock acquires the lock in the replicated state. A lock held in the local copy of the state is reported as
+// ErrLockExists without going through raft, so requests waiting for a held lock do not append a log entry per
+// retry. On followers the local copy may lag slightly behind, a lock released just now is then acquired by the
+// next retry.
+func (n *Node) Lock(ctx context.Context, namespace, name string, pid int32, addr string) error {
+	if n.fsm.held(namespace, name) {
+		return types.ErrLockExists
+	}
+	return n.submit(ctx, command{Op: opLock, Namespace: namespace, Name: name, Pid: pid, Addr: addr})
+}
+
+// Unlock releases the lock in the replicated state if it is held by pid and addr.
+func (n *Node) Unlock(ctx context.Context, namespace, name string, pid int32, addr string) error {
+	return n.submit(ctx, command{Op: opUnlock, Namespace: namespace, Name: name, Pid: pid, Addr: addr})
+}
+
+// UnlockByName releases the lock in the replicated state regardless of its holder.
+func (n *Node) UnlockByName(ctx context.Context, namespace, name string) error {
+	return n.submit(ctx, command{Op: opUnlockByName, Namespace: namespace, Name: name})
+}
+
+// Restore replaces all locks in the replicated state.
+func (n *Node) Restore(ctx context.Context, locks []types.LockInfo) error {
+	return n.submit(ctx, command{Op: opRestore, Locks: locks})
+}
+
+// GetLocks returns the locks known to this node. On followers the state may lag slightly behind the leader.
+func (n *Node) GetLocks(_ context.Context) []types.LockInfo {
+	return n.fsm.getLocks()
+}
+
+// Apply applies an encoded command on this node, it is called for commands forwarded by followers.
+func (n *Node) Apply(data []byte) error {
+	if !n.IsLeader() {
+		return raft.ErrNotLeader
+	}
+	f := n.raft.Apply(data, applyTimeout)
+	if err := f.Error(); err != nil {
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// submit applies the command locally when leading or forwards it to the leader.
+func (n *Node) submit(ctx context.Context, cmd command) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if n.IsLeader() {
+		return n.Apply(data)
+	}
+	err = n.forward(ctx, data)
+	if err != nil && cmd.Op == opLock && !errors.Is(err, types.ErrLockExists) && !errors.Is(err, ErrNoLeader) {
+		// the leader may have committed the lock before the forward failed, release it so it is not held by an
+		// owner that does not know about it
+		release, _ := json.Marshal(command{Op: opUnlock, Namespace: cmd.Namespace, Name: cmd.Name, Pid: cmd.Pid, Addr: cmd.Addr})
+		if unlockErr := n.forward(ctx, release); unlockErr != nil && !errors.Is(unlockErr, types.ErrStrangersLock) {
+			n.logger.Warn("releasing lock after failed forward", "namespace", cmd.Namespace, "name", cmd.Name, "error", unlockErr)
+		}
+	}
+	return err
+}
+
+// forward sends an encoded command to the ClusterService of the current leader. The request is not canceled with
+// ctx, a command the leader may already have committed is always answered, bounded by applyTimeout.
+func (n *Node) forward(ctx context.Context, data []byte) error {
+	_, id := n.raft.LeaderWithID()
+	peer, ok := n.peers[id]
+	if id == "" || !ok {
+		return ErrNoLeader
+	}
+	conn, err := n.connection(peer.GRPCAddr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), applyTimeout)
+	defer cancel()
+	resp, err := pb.NewClusterServiceClient(conn).Apply(ctx, &pb.ApplyRequest{Command: data})
+	if err != nil {
+		return err
+	}
+	return toError(resp.GetError())
+}
+
+// connection returns a cached gRPC connection to addr.
+func (n *Node) connection(addr string) (*grpc.ClientConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if conn, ok := n.clients[addr]; ok {
+		return conn, nil
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(n.creds),
+		grpc.WithPerRPCCredentials(secretCredentials(n.secret)),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(n.trace...)),
+	}
+	if n.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.BearerToken{Token: n.token}))
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	n.clients[addr] = conn
+	return conn, nil
+}
+
+// toError maps an error message received from the leader back to the well known lock errors.
+func toError(message string) error {
+	switch message {
+	case "":
+		return nil
+	case types.ErrLockExists.Error():
+		return types.ErrLockExists
+	case types.ErrStrangersLock.Error():
+		return types.ErrStrangersLock
+	}
+	return errors.New(message)
+}
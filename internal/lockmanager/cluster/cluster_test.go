@@ -0,0 +1,213 @@
+package cluster_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/cluster"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+	"github.com/sascha-andres/lockutil/server"
+)
+
+// secret is the cluster secret shared by the test nodes.
+const secret = "test-secret"
+
+// testNode is a cluster node serving the ClusterService on a local port.
+type testNode struct {
+	*cluster.Node
+	id        string
+	transport *raft.InmemTransport
+	grpcAddr  string
+	closed    bool
+}
+
+// startCluster starts size nodes connected by in-memory raft transports, stopping them when the test ends.
+func startCluster(t *testing.T, size int) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, size)
+	listeners := make([]net.Listener, size)
+	peers := make([]cluster.Peer, size)
+	for i := range nodes {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listening: %v", err)
+		}
+		id := fmt.Sprintf("n%d", i+1)
+		addr, transport := raft.NewInmemTransport(raft.ServerAddress(id))
+		listeners[i] = lis
+		nodes[i] = &testNode{id: id, transport: transport, grpcAddr: lis.Addr().String()}
+		peers[i] = cluster.Peer{ID: id, RaftAddr: string(addr), GRPCAddr: nodes[i].grpcAddr}
+	}
+	for _, a := range nodes {
+		for _, b := range nodes {
+			if a != b {
+				a.transport.Connect(raft.ServerAddress(b.id), b.transport)
+			}
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for i, n := range nodes {
+		node, err := cluster.NewNode(cluster.Config{ID: n.id, Peers: peers, Transport: n.transport, Secret: secret, Logger: logger})
+		if err != nil {
+			t.Fatalf("starting node %s: %v", n.id, err)
+		}
+		n.Node = node
+		clusterServer, err := server.NewClusterServer(node, secret, nil, server.WithClusterLogger(logger))
+		if err != nil {
+			t.Fatalf("creating cluster server: %v", err)
+		}
+		grpcServer := grpc.NewServer()
+		pb.RegisterClusterServiceServer(grpcServer, clusterServer)
+		go func() {
+			_ = grpcServer.Serve(listeners[i])
+		}()
+		t.Cleanup(func() {
+			grpcServer.Stop()
+			n.close()
+		})
+	}
+	return nodes
+}
+
+// close stops the node and disconnects its transport.
+func (n *testNode) close() {
+	if n.closed {
+		return
+	}
+	n.closed = true
+	_ = n.Close()
+	n.transport.DisconnectAll()
+}
+
+// waitFor polls cond until it is true or fails the test after timeout.
+func waitFor(t *testing.T, what string, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// leader waits for one of the running nodes to become leader and returns it.
+func leader(t *testing.T, nodes []*testNode) *testNode {
+	t.Helper()
+	var found *testNode
+	waitFor(t, "a leader", 15*time.Second, func() bool {
+		for _, n := range nodes {
+			if !n.closed && n.IsLeader() {
+				found = n
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// follower returns a running node that is not the leader.
+func follower(nodes []*testNode, leader *testNode) *testNode {
+	for _, n := range nodes {
+		if !n.closed && n != leader {
+			return n
+		}
+	}
+	return nil
+}
+
+// holder returns the holder of the lock as known to n, ok is false if the lock is not held.
+func holder(n *testNode, name string) (types.LockInfo, bool) {
+	for _, lock := range n.GetLocks(context.Background()) {
+		if lock.Name == name && lock.IsLocked {
+			return lock, true
+		}
+	}
+	return types.LockInfo{}, false
+}
+
+// waitReplicated waits until all running nodes agree on whether the lock is held and by whom.
+func waitReplicated(t *testing.T, nodes []*testNode, name string, held bool, pid int32) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("lock %q to be replicated", name), 5*time.Second, func() bool {
+		for _, n := range nodes {
+			if n.closed {
+				continue
+			}
+			lock, ok := holder(n, name)
+			if ok != held || (held && lock.Pid != pid) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestClusterReplicatesLocksAndFailsOver(t *testing.T) {
+	nodes := startCluster(t, 3)
+	ctx := context.Background()
+	first := leader(t, nodes)
+
+	// acquiring through a follower forwards the command to the leader
+	if err := follower(nodes, first).Lock(ctx, types.DefaultNamespace, "db", 1, "client-a"); err != nil {
+		t.Fatalf("locking through follower: %v", err)
+	}
+	waitReplicated(t, nodes, "db", true, 1)
+	for _, n := range nodes {
+		if err := n.Lock(ctx, types.DefaultNamespace, "db", 2, "client-b"); !errors.Is(err, types.ErrLockExists) {
+			t.Errorf("locking held lock on %s: expected %v, got %v", n.id, types.ErrLockExists, err)
+		}
+	}
+
+	first.close()
+	second := leader(t, nodes)
+	if lock, ok := holder(second, "db"); !ok || lock.Pid != 1 {
+		t.Fatalf("new leader %s lost the lock, got %+v", second.id, lock)
+	}
+	if err := follower(nodes, second).Unlock(ctx, types.DefaultNamespace, "db", 1, "client-a"); err != nil {
+		t.Fatalf("unlocking through follower after failover: %v", err)
+	}
+	waitReplicated(t, nodes, "db", false, 0)
+	if err := second.Lock(ctx, types.DefaultNamespace, "db", 2, "client-b"); err != nil {
+		t.Fatalf("locking released lock on new leader: %v", err)
+	}
+	waitReplicated(t, nodes, "db", true, 2)
+}
+
+func TestClusterServiceRequiresSecret(t *testing.T) {
+	nodes := startCluster(t, 3)
+	l := leader(t, nodes)
+
+	conn, err := grpc.NewClient(l.grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("connecting to leader: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, err = pb.NewClusterServiceClient(conn).Apply(context.Background(), &pb.ApplyRequest{Command: []byte(`{"op":"restore"}`)})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected %v without cluster secret, got %v", codes.PermissionDenied, err)
+	}
+
+	if _, err := server.NewClusterServer(l.Node, "", nil); !errors.Is(err, cluster.ErrNoSecret) {
+		t.Errorf("expected %v for an empty secret, got %v", cluster.ErrNoSecret, err)
+	}
+	if _, err := cluster.NewNode(cluster.Config{ID: "n1"}); !errors.Is(err, cluster.ErrNoSecret) {
+		t.Errorf("expected %v for a node without secret, got %v", cluster.ErrNoSecret, err)
+	}
+}
@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/hashicorp/raft"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/inmemory"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+const (
+
+	// opLock is the command operation acquiring a lock.
+	opLock = "lock"
+
+	// opUnlock is the command operation releasing a lock held by a pid and address.
+	opUnlock = "unlock"
+
+	// opUnlockByName is the command operation releasing a lock regardless of its holder.
+	opUnlockByName = "unlock-by-name"
+
+	// opRestore is the command operation replacing all locks.
+	opRestore = "restore"
+)
+
+// command is a state change replicated through the raft log.
+type command struct {
+
+	// Op is the operation to apply, one of opLock, opUnlock, opUnlockByName or opRestore.
+	Op string `json:"op"`
+
+	// Namespace is the namespace of the lock the operation applies to.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the lock the operation applies to.
+	Name string `json:"name"`
+
+	// Pid is the process ID of the lock holder.
+	Pid int32 `json:"pid,omitempty"`
+
+	// Addr is the address of the lock holder.
+	Addr string `json:"addr,omitempty"`
+
+	// Locks contains the new state for opRestore.
+	Locks []types.LockInfo `json:"locks,omitempty"`
+}
+
+// fsm is the raft state machine holding the replicated lock state.
+type fsm struct {
+	locker *inmemory.Locker
+}
+
+// newFSM creates an empty state machine.
+func newFSM() *fsm {
+	return &fsm{locker: inmemory.NewInMemoryLocker()}
+}
+
+// apply executes a command against the local lock state and returns the resulting error.
+// Committed commands must always be applied, so the local state is not bound to any request context.
+func (f *fsm) apply(cmd command) error {
+	ctx := context.Background()
+	switch cmd.Op {
+	case opLock:
+		return f.locker.Lock(ctx, cmd.Namespace, cmd.Name, cmd.Pid, cmd.Addr)
+	case opUnlock:
+		return f.locker.Unlock(ctx, cmd.Namespace, cmd.Name, cmd.Pid, cmd.Addr)
+	case opUnlockByName:
+		return f.locker.UnlockByName(ctx, cmd.Namespace, cmd.Name)
+	case opRestore:
+		return f.locker.Restore(ctx, cmd.Locks)
+	}
+	return errors.New("unknown command " + cmd.Op)
+}
+
+// Apply is called by raft once a log entry is committed. The returned value is the error of the operation.
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(l.Data, &cmd); err != nil {
+		return err
+	}
+	return f.apply(cmd)
+}
+
+// Snapshot captures the current lock state for raft log compaction.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &snapshot{locks: f.locker.GetLocks(context.Background())}, nil
+}
+
+// Restore replaces the lock state with the state read from a snapshot.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer func() {
+		_ = rc.Close()
+	}()
+	var locks []types.LockInfo
+	if err := json.NewDecoder(rc).Decode(&locks); err != nil {
+		return err
+	}
+	return f.locker.Restore(context.Background(), locks)
+}
+
+// getLocks returns the locks of the local copy of the replicated state.
+func (f *fsm) getLocks() []types.LockInfo {
+	return f.locker.GetLocks(context.Background())
+}
+
+// held reports whether the lock is held in the local copy of the replicated state.
+func (f *fsm) held(namespace, name string) bool {
+	return f.locker.Held(namespace, name)
+}
+
+// snapshot is a point in time copy of the lock state.
+type snapshot struct {
+	locks []types.LockInfo
+}
+
+// Persist writes the snapshot as JSON to the given sink.
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(s.locks); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Release is a no-op as the snapshot holds no resources.
+func (s *snapshot) Release() {}
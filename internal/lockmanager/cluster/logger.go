@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// raftLogger passes the log records of raft to a slog.Logger. Raft is chatty at info level, so trace, debug and
+// info records are logged at debug level, warnings and errors keep their level.
+type raftLogger struct {
+	logger *slog.Logger
+	name   string
+	args   []any
+}
+
+// newRaftLogger returns a hclog.Logger writing to logger.
+func newRaftLogger(logger *slog.Logger) hclog.Logger {
+	return &raftLogger{logger: logger.With("component", "raft")}
+}
+
+// level maps a hclog level to the slog level used for its records.
+func level(l hclog.Level) slog.Level {
+	switch l {
+	case hclog.Warn:
+		return slog.LevelWarn
+	case hclog.Error:
+		return slog.LevelError
+	}
+	return slog.LevelDebug
+}
+
+// Log emits a record at the slog level matching l.
+func (r *raftLogger) Log(l hclog.Level, msg string, args ...any) {
+	if l == hclog.Off {
+		return
+	}
+	if r.name != "" {
+		msg = r.name + ": " + msg
+	}
+	r.logger.Log(context.Background(), level(l), msg, append(r.args, args...)...)
+}
+
+// Trace emits a record at debug level.
+func (r *raftLogger) Trace(msg string, args ...any) { r.Log(hclog.Trace, msg, args...) }
+
+// Debug emits a record at debug level.
+func (r *raftLogger) Debug(msg string, args ...any) { r.Log(hclog.Debug, msg, args...) }
+
+// Info emits a record at debug level.
+func (r *raftLogger) Info(msg string, args ...any) { r.Log(hclog.Info, msg, args...) }
+
+// Warn emits a record at warn level.
+func (r *raftLogger) Warn(msg string, args ...any) { r.Log(hclog.Warn, msg, args...) }
+
+// Error emits a record at error level.
+func (r *raftLogger) Error(msg string, args ...any) { r.Log(hclog.Error, msg, args...) }
+
+// enabled reports whether records of level l are written.
+func (r *raftLogger) enabled(l hclog.Level) bool {
+	return r.logger.Enabled(context.Background(), level(l))
+}
+
+// IsTrace reports whether trace records are written.
+func (r *raftLogger) IsTrace() bool { return r.enabled(hclog.Trace) }
+
+// IsDebug reports whether debug records are written.
+func (r *raftLogger) IsDebug() bool { return r.enabled(hclog.Debug) }
+
+// IsInfo reports whether info records are written.
+func (r *raftLogger) IsInfo() bool { return r.enabled(hclog.Info) }
+
+// IsWarn reports whether warnings are written.
+func (r *raftLogger) IsWarn() bool { return r.enabled(hclog.Warn) }
+
+// IsError reports whether errors are written.
+func (r *raftLogger) IsError() bool { return r.enabled(hclog.Error) }
+
+// ImpliedArgs returns the key/value pairs added using With.
+func (r *raftLogger) ImpliedArgs() []any { return r.args }
+
+// With returns a logger adding args to every record.
+func (r *raftLogger) With(args ...any) hclog.Logger {
+	c := *r
+	c.args = append(append([]any{}, r.args...), args...)
+	return &c
+}
+
+// Name returns the name of the logger.
+func (r *raftLogger) Name() string { return r.name }
+
+// Named returns a logger with name appended to the current name.
+func (r *raftLogger) Named(name string) hclog.Logger {
+	if r.name != "" {
+		name = r.name + "." + name
+	}
+	return r.ResetNamed(name)
+}
+
+// ResetNamed returns a logger with the given name.
+func (r *raftLogger) ResetNamed(name string) hclog.Logger {
+	c := *r
+	c.name = name
+	return &c
+}
+
+// SetLevel is a no-op, the level is controlled by the slog handler.
+func (r *raftLogger) SetLevel(hclog.Level) {}
+
+// GetLevel returns the lowest hclog level written.
+func (r *raftLogger) GetLevel() hclog.Level {
+	for _, l := range []hclog.Level{hclog.Trace, hclog.Warn, hclog.Error} {
+		if r.enabled(l) {
+			return l
+		}
+	}
+	return hclog.Off
+}
+
+// StandardLogger returns a log.Logger writing to this logger.
+func (r *raftLogger) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	return log.New(r.StandardWriter(opts), "", 0)
+}
+
+// StandardWriter returns a writer logging each line written at info level.
+func (r *raftLogger) StandardWriter(*hclog.StandardLoggerOptions) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		r.Info(strings.TrimSpace(string(p)))
+		return len(p), nil
+	})
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+// Write calls f.
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
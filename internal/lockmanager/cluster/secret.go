@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// SecretMetadata is the gRPC metadata key nodes send the cluster secret in when forwarding commands.
+const SecretMetadata = "x-lockd-cluster-secret"
+
+// secretCredentials attaches the cluster secret to every call to the ClusterService.
+type secretCredentials string
+
+// GetRequestMetadata returns the metadata carrying the cluster secret.
+func (s secretCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{SecretMetadata: string(s)}, nil
+}
+
+// RequireTransportSecurity reports whether the secret may only be sent over secured connections, it is sent
+// over the connections configured for the cluster in any case.
+func (s secretCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// VerifySecret reports whether the incoming call carries the cluster secret. An empty secret matches no call.
+func VerifySecret(ctx context.Context, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(SecretMetadata)
+	if len(values) != 1 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(values[0]), []byte(secret)) == 1
+}
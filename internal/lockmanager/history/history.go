@@ -0,0 +1,154 @@
+package history
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType identifies what happened to a lock.
+type EventType string
+
+const (
+
+	// EventAcquire is recorded when a lock has been acquired.
+	EventAcquire EventType = "acquire"
+
+	// EventRelease is recorded when a lock has been released by its holder.
+	EventRelease EventType = "release"
+
+	// EventForceRelease is recorded when a lock has been released using the force token.
+	EventForceRelease EventType = "force-release"
+
+	// EventTimeout is recorded when waiting for a lock timed out.
+	EventTimeout EventType = "timeout"
+
+	// EventCancel is recorded when a client stopped waiting for a lock.
+	EventCancel EventType = "cancel"
+
+	// EventQueued is recorded when a lock request starts waiting because the lock is held.
+	EventQueued EventType = "queued"
+)
+
+// DefaultSize is the number of events kept by a Ring when a non-positive size is requested.
+const DefaultSize = 1000
+
+// Event describes a single change of a lock.
+type Event struct {
+
+	// Time is the point in time the event happened.
+	Time time.Time
+
+	// Type is the kind of event.
+	Type EventType
+
+	// Namespace is the namespace of the lock.
+	Namespace string
+
+	// Name is the name of the lock.
+	Name string
+
+	// Pid is the process ID of the client causing the event.
+	Pid int32
+
+	// Addr is the address of the client causing the event.
+	Addr string
+
+	// Duration is the time waited for acquire, timeout and cancel events and the time the lock was held for release
+	// events, 0 for queued events.
+	Duration time.Duration
+}
+
+// Filter restricts the events returned by a query. Zero values match everything.
+type Filter struct {
+
+	// Namespace only matches events of locks in this namespace.
+	Namespace string
+
+	// Name only matches events of the lock with this name.
+	Name string
+
+	// Prefix only matches events of locks whose name starts with this prefix.
+	Prefix string
+
+	// Since only matches events at or after this time.
+	Since time.Time
+
+	// Until only matches events before this time.
+	Until time.Time
+}
+
+// Matches reports whether the event is selected by the filter.
+func (f Filter) Matches(e Event) bool {
+	if f.Namespace != "" && f.Namespace != e.Namespace {
+		return false
+	}
+	if f.Name != "" && f.Name != e.Name {
+		return false
+	}
+	if !strings.HasPrefix(e.Name, f.Prefix) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Recorder stores lock events. Implementations backed by persistent storage keep the history across restarts.
+type Recorder interface {
+
+	// Record stores an event.
+	Record(e Event)
+
+	// Query returns all stored events matching the filter, oldest first.
+	Query(f Filter) []Event
+}
+
+// Ring is an in-memory Recorder keeping the most recent events in a fixed size ring buffer.
+type Ring struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewRing creates a Ring keeping up to size events.
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Ring{events: make([]Event, size)}
+}
+
+// Record stores an event, overwriting the oldest one when the ring is full.
+func (r *Ring) Record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Query returns all stored events matching the filter, oldest first.
+func (r *Ring) Query(f Filter) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]Event, 0)
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, len(r.events)
+	}
+	for i := 0; i < count; i++ {
+		e := r.events[(start+i)%len(r.events)]
+		if f.Matches(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -1,6 +1,7 @@
 package inmemory
 
 import (
+	"context"
 	"sync"
 
 	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
@@ -9,63 +10,86 @@ import (
 // Locker is a simple in-memory lock manager.
 type Locker struct {
 	mu    sync.Mutex
-	locks map[string]*lockInfo
+	locks map[types.Key]*lockInfo
 }
 
 // UnlockByName releases the lock identified by its name without considering the owner.
 // The method returns an error if the operation fails.
-func (i *Locker) UnlockByName(name string) error {
+func (i *Locker) UnlockByName(_ context.Context, namespace, name string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
-	delete(i.locks, name)
+	delete(i.locks, types.Key{Namespace: namespace, Name: name})
 	return nil
 }
 
-// Lock attempts to acquire a lock with the given name for the specified pid.
+// Lock attempts to acquire a lock with the given namespace and name for the specified pid.
 // Returns ErrLockExists if the lock is already held.
-func (i *Locker) Lock(name string, pid int32, addr string) error {
+func (i *Locker) Lock(_ context.Context, namespace, name string, pid int32, addr string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
-	lock, exists := i.locks[name]
+	key := types.Key{Namespace: namespace, Name: name}
+	lock, exists := i.locks[key]
 	if !exists || (exists && !lock.isLocked) {
 		// Acquire lock if it does not exist or is not currently locked
-		i.locks[name] = &lockInfo{pid: pid, isLocked: true, addr: addr}
+		i.locks[key] = &lockInfo{pid: pid, isLocked: true, addr: addr}
 		return nil
 	}
 	return types.ErrLockExists
 }
 
+// Held reports whether the lock with the given namespace and name is currently held.
+func (i *Locker) Held(namespace, name string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	lock, exists := i.locks[types.Key{Namespace: namespace, Name: name}]
+	return exists && lock.isLocked
+}
+
 // Unlock attempts to release a lock identified by the name for the given pid.
 // Returns ErrStrangersLock if the lock is held by a different PID or does not exist.
-func (i *Locker) Unlock(name string, pid int32, addr string) error {
+func (i *Locker) Unlock(_ context.Context, namespace, name string, pid int32, addr string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if lock, exists := i.locks[name]; exists && lock.isLocked && lock.pid == pid && lock.addr == addr {
+	key := types.Key{Namespace: namespace, Name: name}
+	if lock, exists := i.locks[key]; exists && lock.isLocked && lock.pid == pid && lock.addr == addr {
 		// Only release if the PID matches the lock holder's PID
-		delete(i.locks, name)
+		delete(i.locks, key)
 		return nil
 	}
 	return types.ErrStrangersLock
 }
 
 // GetLocks returns a slice of LockInfo representing all current locks managed by the InMemoryLocker.
-func (i *Locker) GetLocks() []types.LockInfo {
+func (i *Locker) GetLocks(_ context.Context) []types.LockInfo {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	locks := make([]types.LockInfo, 0, len(i.locks))
-	for name, lock := range i.locks {
+	for key, lock := range i.locks {
 		locks = append(locks, types.LockInfo{
-			Pid:      lock.pid,
-			Addr:     lock.addr,
-			IsLocked: lock.isLocked,
-			Name:     name,
+			Pid:       lock.pid,
+			Addr:      lock.addr,
+			IsLocked:  lock.isLocked,
+			Name:      key.Name,
+			Namespace: key.Namespace,
 		})
 	}
 	return locks
 }
 
+// Restore replaces all current locks with the given locks.
+func (i *Locker) Restore(_ context.Context, locks []types.LockInfo) error {
+	restored := make(map[types.Key]*lockInfo, len(locks))
+	for _, lock := range locks {
+		restored[types.Key{Namespace: types.Namespace(lock.Namespace), Name: lock.Name}] = &lockInfo{pid: lock.Pid, addr: lock.Addr, isLocked: lock.IsLocked}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.locks = restored
+	return nil
+}
+
 // lockInfo represents the lock status and the process ID (pid) holding the lock.
 type lockInfo struct {
 
@@ -82,6 +106,6 @@ type lockInfo struct {
 // NewInMemoryLocker creates and initializes a new InMemoryLocker instance.
 func NewInMemoryLocker() *Locker {
 	return &Locker{
-		locks: make(map[string]*lockInfo),
+		locks: make(map[types.Key]*lockInfo),
 	}
 }
@@ -1,13 +1,26 @@
 package lockmanager
 
 import (
+	"context"
 	"errors"
-	"log"
+	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
 
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
 	"github.com/sascha-andres/lockutil/internal/lockmanager/inmemory"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/snapshot"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/stats"
+	"github.com/sascha-andres/lockutil/internal/metrics"
+	"github.com/sascha-andres/lockutil/internal/tracing"
 )
 
 // LockManager manages named locks with optional timeout waits.
@@ -16,67 +29,337 @@ type LockManager struct {
 	// locker provides methods for acquiring and releasing locks, typically used by the LockManager to manage named locks.
 	locker types.Locker
 
-	// verbose indicates whether to log detailed information about lock operations.
-	verbose bool
+	// logger receives detailed information about lock operations at debug level.
+	logger *slog.Logger
+
+	// tracer creates spans for acquire waits, releases and backend operations.
+	tracer trace.Tracer
+
+	// history records acquire, release and timeout events.
+	history history.Recorder
+
+	// metrics receives lock events and waiter counts, nil to disable metrics.
+	metrics *metrics.Metrics
+
+	// stats accumulates contention statistics per lock from the recorded events and queue lengths.
+	stats *stats.Collector
+
+	// mu guards acquired and waiters.
+	mu sync.Mutex
+
+	// acquired holds the point in time each lock was acquired through this manager, used to compute hold durations.
+	acquired map[types.Key]time.Time
+
+	// waiters holds the requests waiting for a lock, longest waiting first.
+	waiters map[types.Key][]*types.Waiter
+
+	// watchMu guards watchers.
+	watchMu sync.Mutex
+
+	// watchers receive every recorded event matching their filter.
+	watchers map[*watcher]struct{}
+}
+
+// LockManagerOption defines a function type that modifies some aspect of a LockManager during its creation.
+type LockManagerOption func(*LockManager)
+
+// WithLocker sets the locker used to store locks, defaults to an in-memory locker.
+func WithLocker(locker types.Locker) LockManagerOption {
+	return func(lm *LockManager) {
+		lm.locker = locker
+	}
+}
+
+// WithHistory sets the recorder for lock events, defaults to an in-memory ring buffer.
+func WithHistory(recorder history.Recorder) LockManagerOption {
+	return func(lm *LockManager) {
+		lm.history = recorder
+	}
+}
+
+// WithLogger sets the logger for lock operations, defaults to slog.Default().
+func WithLogger(logger *slog.Logger) LockManagerOption {
+	return func(lm *LockManager) {
+		lm.logger = logger
+	}
+}
+
+// WithTracerProvider sets the provider of the tracer creating spans for lock operations, defaults to the global
+// provider.
+func WithTracerProvider(tp trace.TracerProvider) LockManagerOption {
+	return func(lm *LockManager) {
+		lm.tracer = tp.Tracer(tracing.Name)
+	}
+}
+
+// WithMetrics exports lock events, wait and hold durations and waiters to m.
+func WithMetrics(m *metrics.Metrics) LockManagerOption {
+	return func(lm *LockManager) {
+		lm.metrics = m
+	}
 }
 
 // NewLockManager creates a new LockManager instance
-func NewLockManager(verbose bool) *LockManager {
-	return &LockManager{
-		locker:  inmemory.NewInMemoryLocker(),
-		verbose: verbose,
+func NewLockManager(opts ...LockManagerOption) *LockManager {
+	lm := &LockManager{
+		locker:   inmemory.NewInMemoryLocker(),
+		logger:   slog.Default(),
+		tracer:   otel.GetTracerProvider().Tracer(tracing.Name),
+		history:  history.NewRing(history.DefaultSize),
+		stats:    stats.NewCollector(),
+		acquired: make(map[types.Key]time.Time),
+		waiters:  make(map[types.Key][]*types.Waiter),
+		watchers: make(map[*watcher]struct{}),
+	}
+	for _, opt := range opts {
+		if nil == opt {
+			continue
+		}
+		opt(lm)
 	}
+	return lm
 }
 
-// RequestLock attempts to acquire a lock with the given name and PID, waiting up to timeoutSeconds.
-func (lm *LockManager) RequestLock(name string, pid int32, addr string, timeoutSeconds int32) error {
+// RequestLock attempts to acquire a lock with the given namespace, name and PID, waiting up to timeoutSeconds.
+// types.ErrLockTimeout is returned when the lock was not acquired in time, with a timeout of 0 when it is held.
+// Waiting stops immediately and the context error is returned once ctx is done, e.g. when the client disconnects.
+func (lm *LockManager) RequestLock(ctx context.Context, namespace, name string, pid int32, addr string, timeoutSeconds int32) error {
 	if timeoutSeconds < 0 {
 		return errors.New("timeoutSeconds must be greater than or equal to 0")
 	}
+	key := types.Key{Namespace: types.Namespace(namespace), Name: name}
+	ctx, span := lm.tracer.Start(ctx, "lock.acquire", trace.WithAttributes(lockAttributes(key, pid, addr, attribute.Int("lock.timeout_seconds", int(timeoutSeconds)))...))
+	defer span.End()
+	start := time.Now()
 	waitDuration := time.Duration(timeoutSeconds) * time.Second
 	timeout := time.After(waitDuration)
 	ticker := time.NewTicker(100 * time.Millisecond) // Poll every 100 ms
 	defer ticker.Stop()
+	waiting := false
+	attempts := 0
 
 	for {
-		err := lm.locker.Lock(name, pid, addr)
+		var err error
+		if !waiting {
+			err = lm.backend(ctx, "lock", key, func(ctx context.Context) error {
+				return lm.locker.Lock(ctx, key.Namespace, key.Name, pid, addr)
+			})
+		} else {
+			// retries while waiting are counted on the wait span instead of creating a span each
+			attempts++
+			err = lm.locker.Lock(ctx, key.Namespace, key.Name, pid, addr)
+		}
 		if err == nil {
-			if lm.verbose {
-				log.Printf("Acquired lock for %s from %s-%d", name, addr, pid)
-			}
+			lm.logger.Debug("lock acquired", "namespace", key.Namespace, "lock", name, "pid", pid, "addr", addr, "duration", time.Since(start))
+			outcome(span, "acquired", nil)
+			lm.acquiredAt(key, pid, addr, start)
 			return nil
 		}
 		if errors.Is(err, types.ErrLockExists) && timeoutSeconds == 0 {
-			if lm.verbose {
-				log.Printf("no lock for %s from %s-%d: already taken", name, addr, pid)
-			}
-			return nil
+			lm.logger.Debug("lock already taken", "namespace", key.Namespace, "lock", name, "pid", pid, "addr", addr)
+			outcome(span, "taken", nil)
+			lm.record(history.EventTimeout, key, pid, addr, time.Since(start))
+			return types.ErrLockTimeout
+		}
+
+		if !waiting {
+			waiting = true
+			_, wait := lm.tracer.Start(ctx, "lock.wait", trace.WithAttributes(lockAttributes(key, pid, addr)...))
+			defer func() {
+				wait.SetAttributes(attribute.Int("lock.attempts", attempts))
+				wait.End()
+			}()
+			lm.record(history.EventQueued, key, pid, addr, 0)
+			defer lm.wait(key, &types.Waiter{Pid: pid, Addr: addr, Since: start})()
+			lm.metrics.Waiting(key.Namespace, key.Name, 1)
+			defer lm.metrics.Waiting(key.Namespace, key.Name, -1)
 		}
 
-		// Wait for the lock to be released or timeout
+		// Wait for the lock to be released, the timeout or the request to be cancelled
 		select {
+		case <-ctx.Done():
+			lm.logger.Debug("waiting for lock cancelled", "namespace", key.Namespace, "lock", name, "pid", pid, "addr", addr, "duration", time.Since(start), "error", ctx.Err())
+			outcome(span, "cancelled", ctx.Err())
+			lm.record(history.EventCancel, key, pid, addr, time.Since(start))
+			return ctx.Err()
 		case <-timeout:
-			if lm.verbose {
-				log.Printf("timeout before acquiring lock for %s from %s-%d", name, addr, pid)
-			}
-			return nil
+			lm.logger.Debug("timeout waiting for lock", "namespace", key.Namespace, "lock", name, "pid", pid, "addr", addr, "duration", time.Since(start))
+			outcome(span, "timeout", nil)
+			lm.record(history.EventTimeout, key, pid, addr, time.Since(start))
+			return types.ErrLockTimeout
 		case <-ticker.C:
 			// Retry acquiring the lock
 		}
 	}
 }
 
-// ReleaseLock releases the lock for the given name and PID.
-func (lm *LockManager) ReleaseLock(name string, pid int32, addr string) error {
-	return lm.locker.Unlock(name, pid, addr)
+// ReleaseLock releases the lock for the given namespace, name and PID.
+func (lm *LockManager) ReleaseLock(ctx context.Context, namespace, name string, pid int32, addr string) error {
+	key := types.Key{Namespace: types.Namespace(namespace), Name: name}
+	ctx, span := lm.tracer.Start(ctx, "lock.release", trace.WithAttributes(lockAttributes(key, pid, addr)...))
+	defer span.End()
+	err := lm.backend(ctx, "unlock", key, func(ctx context.Context) error {
+		return lm.locker.Unlock(ctx, key.Namespace, key.Name, pid, addr)
+	})
+	if err != nil {
+		outcome(span, "failed", err)
+		return err
+	}
+	outcome(span, "released", nil)
+	lm.released(history.EventRelease, key, pid, addr)
+	return nil
+}
+
+// GetLocks returns a slice of LockInfo representing all the current locks of all namespaces and their statuses.
+func (lm *LockManager) GetLocks(ctx context.Context) []types.LockInfo {
+	ctx, span := lm.tracer.Start(ctx, "lock.backend.get_locks")
+	defer span.End()
+	locks := lm.locker.GetLocks(ctx)
+	span.SetAttributes(attribute.Int("lock.count", len(locks)))
+	return locks
+}
+
+// ReleaseLockByName releases the lock identified by its namespace and name.
+func (lm *LockManager) ReleaseLockByName(ctx context.Context, namespace, name string) error {
+	key := types.Key{Namespace: types.Namespace(namespace), Name: name}
+	ctx, span := lm.tracer.Start(ctx, "lock.force_release", trace.WithAttributes(
+		attribute.String("lock.namespace", namespace),
+		attribute.String("lock.name", name),
+	))
+	defer span.End()
+	holder := types.LockInfo{}
+	for _, lock := range lm.GetLocks(ctx) {
+		if lock.Namespace == key.Namespace && lock.Name == key.Name {
+			holder = lock
+		}
+	}
+	span.SetAttributes(attribute.Int("lock.pid", int(holder.Pid)), attribute.String("lock.addr", holder.Addr))
+	err := lm.backend(ctx, "unlock_by_name", key, func(ctx context.Context) error {
+		return lm.locker.UnlockByName(ctx, key.Namespace, key.Name)
+	})
+	if err != nil {
+		outcome(span, "failed", err)
+		return err
+	}
+	outcome(span, "released", nil)
+	lm.released(history.EventForceRelease, key, holder.Pid, holder.Addr)
+	return nil
+}
+
+// HeldSince returns the point in time the lock was acquired through this manager, the zero time if it is not
+// known, e.g. because it was acquired on another cluster node.
+func (lm *LockManager) HeldSince(namespace, name string) time.Time {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.acquired[types.Key{Namespace: types.Namespace(namespace), Name: name}]
+}
+
+// Waiters returns the requests waiting for the lock through this manager, longest waiting first.
+func (lm *LockManager) Waiters(namespace, name string) []types.Waiter {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	waiters := lm.waiters[types.Key{Namespace: types.Namespace(namespace), Name: name}]
+	result := make([]types.Waiter, 0, len(waiters))
+	for _, w := range waiters {
+		result = append(result, *w)
+	}
+	return result
+}
+
+// wait registers a waiting request and returns the function removing it again.
+func (lm *LockManager) wait(key types.Key, w *types.Waiter) func() {
+	lm.mu.Lock()
+	lm.waiters[key] = append(lm.waiters[key], w)
+	waiting := len(lm.waiters[key])
+	lm.mu.Unlock()
+	lm.stats.Queue(key, waiting)
+	return func() {
+		lm.mu.Lock()
+		defer lm.mu.Unlock()
+		waiters := slices.DeleteFunc(lm.waiters[key], func(other *types.Waiter) bool { return other == w })
+		if len(waiters) == 0 {
+			delete(lm.waiters, key)
+			return
+		}
+		lm.waiters[key] = waiters
+	}
+}
+
+// History returns the recorded lock events matching the filter, oldest first.
+func (lm *LockManager) History(f history.Filter) []history.Event {
+	return lm.history.Query(f)
+}
+
+// Stats returns the contention statistics of the locks for which match returns true and their totals, collected
+// from the requests handled by this manager since it was created.
+func (lm *LockManager) Stats(match func(namespace, name string) bool) ([]stats.Lock, stats.Lock, time.Time) {
+	locks, total := lm.stats.Query(match)
+	return locks, total, lm.stats.Since()
+}
+
+// acquiredAt records an acquire event for a lock and remembers when it was acquired.
+func (lm *LockManager) acquiredAt(key types.Key, pid int32, addr string, waitStart time.Time) {
+	lm.mu.Lock()
+	lm.acquired[key] = time.Now()
+	lm.mu.Unlock()
+	lm.record(history.EventAcquire, key, pid, addr, time.Since(waitStart))
+}
+
+// released records a release event for a lock including how long it was held.
+func (lm *LockManager) released(eventType history.EventType, key types.Key, pid int32, addr string) {
+	lm.mu.Lock()
+	since, ok := lm.acquired[key]
+	delete(lm.acquired, key)
+	lm.mu.Unlock()
+	held := time.Duration(0)
+	if ok {
+		held = time.Since(since)
+	}
+	lm.logger.Debug("lock released", "namespace", key.Namespace, "lock", key.Name, "pid", pid, "addr", addr, "duration", held, "forced", eventType == history.EventForceRelease)
+	lm.record(eventType, key, pid, addr, held)
+}
+
+// record stores a lock event in the history, exports it as metric and passes it to the watchers.
+func (lm *LockManager) record(eventType history.EventType, key types.Key, pid int32, addr string, duration time.Duration) {
+	lm.metrics.Event(eventType, key.Namespace, duration)
+	e := history.Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Namespace: key.Namespace,
+		Name:      key.Name,
+		Pid:       pid,
+		Addr:      addr,
+		Duration:  duration,
+	}
+	lm.history.Record(e)
+	lm.stats.Record(e)
+	lm.notify(e)
 }
 
-// GetLocks returns a slice of LockInfo representing all the current locks and their statuses.
-func (lm *LockManager) GetLocks() []types.LockInfo {
-	return lm.locker.GetLocks()
+// Snapshot returns a versioned copy of the complete lock state.
+func (lm *LockManager) Snapshot(ctx context.Context) *snapshot.Snapshot {
+	return snapshot.New(lm.locker.GetLocks(ctx))
 }
 
-// ReleaseLockByName releases the lock identified by its name.
-func (lm *LockManager) ReleaseLockByName(name string) error {
-	return lm.locker.UnlockByName(name)
+// Restore replaces the complete lock state with the state of the given snapshot. The acquire times are forgotten,
+// hold durations of restored locks are not known. Requests waiting for a lock keep waiting, snapshots do not hold
+// waiters. Returns types.ErrRestoreUnsupported if the locker cannot restore its state.
+func (lm *LockManager) Restore(ctx context.Context, s *snapshot.Snapshot) error {
+	restorer, ok := lm.locker.(types.Restorer)
+	if !ok {
+		return types.ErrRestoreUnsupported
+	}
+	lm.logger.Debug("restoring snapshot", "locks", len(s.Locks), "created", s.Created)
+	ctx, span := lm.tracer.Start(ctx, "lock.backend.restore", trace.WithAttributes(attribute.Int("lock.count", len(s.Locks))))
+	defer span.End()
+	err := restorer.Restore(ctx, s.LockInfos())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	lm.mu.Lock()
+	clear(lm.acquired)
+	lm.mu.Unlock()
+	return nil
 }
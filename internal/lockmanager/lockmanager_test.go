@@ -0,0 +1,103 @@
+package lockmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// waitFor polls cond until it is true or fails the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRequestLockTimeout(t *testing.T) {
+	lm := NewLockManager()
+	if err := lm.RequestLock(context.Background(), "", "db", 1, "holder", 0); err != nil {
+		t.Fatalf("acquiring lock: %v", err)
+	}
+	for _, timeout := range []int32{0, 1} {
+		if err := lm.RequestLock(context.Background(), "", "db", 2, "waiter", timeout); !errors.Is(err, types.ErrLockTimeout) {
+			t.Errorf("timeout %d: expected %v, got %v", timeout, types.ErrLockTimeout, err)
+		}
+	}
+}
+
+func TestRequestLockCancelledWhileWaiting(t *testing.T) {
+	lm := NewLockManager()
+	if err := lm.RequestLock(context.Background(), "", "db", 1, "holder", 0); err != nil {
+		t.Fatalf("acquiring lock: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- lm.RequestLock(ctx, "", "db", 2, "waiter", 60)
+	}()
+	waitFor(t, "waiter to be registered", func() bool { return len(lm.Waiters("", "db")) == 1 })
+
+	cancelled := time.Now()
+	cancel()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RequestLock did not return after its context was cancelled")
+	}
+	if elapsed := time.Since(cancelled); elapsed > 200*time.Millisecond {
+		t.Errorf("RequestLock returned %s after cancellation", elapsed)
+	}
+	if waiters := lm.Waiters("", "db"); len(waiters) != 0 {
+		t.Errorf("expected no waiters after cancellation, got %v", waiters)
+	}
+
+	for _, lock := range lm.GetLocks(context.Background()) {
+		if lock.Name == "db" && (lock.Pid != 1 || lock.Addr != "holder") {
+			t.Errorf("lock changed owner to pid %d on %s", lock.Pid, lock.Addr)
+		}
+	}
+}
+
+func TestRequestLockDeadlineWhileWaiting(t *testing.T) {
+	lm := NewLockManager()
+	if err := lm.RequestLock(context.Background(), "", "db", 1, "holder", 0); err != nil {
+		t.Fatalf("acquiring lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := lm.RequestLock(ctx, "", "db", 2, "waiter", 60); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if waiters := lm.Waiters("", "db"); len(waiters) != 0 {
+		t.Errorf("expected no waiters, got %v", waiters)
+	}
+}
+
+func TestRestoreForgetsAcquireTimes(t *testing.T) {
+	lm := NewLockManager()
+	ctx := context.Background()
+	if err := lm.RequestLock(ctx, "", "db", 1, "holder", 0); err != nil {
+		t.Fatalf("acquiring lock: %v", err)
+	}
+	if lm.HeldSince(types.DefaultNamespace, "db").IsZero() {
+		t.Fatalf("expected the acquire time to be known")
+	}
+	if err := lm.Restore(ctx, lm.Snapshot(ctx)); err != nil {
+		t.Fatalf("restoring: %v", err)
+	}
+	if since := lm.HeldSince(types.DefaultNamespace, "db"); !since.IsZero() {
+		t.Errorf("expected the acquire time to be forgotten, got %v", since)
+	}
+}
@@ -0,0 +1,81 @@
+package sharded
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/inmemory"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// DefaultShards is the number of shards used when a non-positive count is requested.
+const DefaultShards = 32
+
+// Locker is an in-memory lock manager spreading lock names over several independently synchronized shards,
+// so operations on different names rarely contend for the same mutex.
+type Locker struct {
+	shards []*inmemory.Locker
+}
+
+// NewShardedLocker creates a Locker with the given number of shards.
+func NewShardedLocker(shards int) *Locker {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	l := &Locker{shards: make([]*inmemory.Locker, shards)}
+	for i := range l.shards {
+		l.shards[i] = inmemory.NewInMemoryLocker()
+	}
+	return l
+}
+
+// shard returns the shard responsible for the lock with the given namespace and name.
+func (l *Locker) shard(namespace, name string) *inmemory.Locker {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(name))
+	return l.shards[h.Sum32()%uint32(len(l.shards))]
+}
+
+// Lock attempts to acquire a lock with the given namespace and name for the specified pid.
+// Returns ErrLockExists if the lock is already held.
+func (l *Locker) Lock(ctx context.Context, namespace, name string, pid int32, addr string) error {
+	return l.shard(namespace, name).Lock(ctx, namespace, name, pid, addr)
+}
+
+// Unlock attempts to release a lock identified by the name for the given pid.
+// Returns ErrStrangersLock if the lock is held by a different PID or does not exist.
+func (l *Locker) Unlock(ctx context.Context, namespace, name string, pid int32, addr string) error {
+	return l.shard(namespace, name).Unlock(ctx, namespace, name, pid, addr)
+}
+
+// UnlockByName releases the lock identified by its name without considering the owner.
+func (l *Locker) UnlockByName(ctx context.Context, namespace, name string) error {
+	return l.shard(namespace, name).UnlockByName(ctx, namespace, name)
+}
+
+// GetLocks returns a slice of LockInfo representing all current locks. Shards are copied one after another,
+// so the result is not a point in time view across all shards.
+func (l *Locker) GetLocks(ctx context.Context) []types.LockInfo {
+	locks := make([]types.LockInfo, 0)
+	for _, s := range l.shards {
+		locks = append(locks, s.GetLocks(ctx)...)
+	}
+	return locks
+}
+
+// Restore replaces all current locks with the given locks.
+func (l *Locker) Restore(ctx context.Context, locks []types.LockInfo) error {
+	partitions := make(map[*inmemory.Locker][]types.LockInfo, len(l.shards))
+	for _, lock := range locks {
+		s := l.shard(types.Namespace(lock.Namespace), lock.Name)
+		partitions[s] = append(partitions[s], lock)
+	}
+	for _, s := range l.shards {
+		if err := s.Restore(ctx, partitions[s]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package stats
+
+import (
+	"cmp"
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// SampleSize is the number of most recent wait and hold durations per lock the percentiles are computed from.
+const SampleSize = 256
+
+// DefaultMaxLocks is the number of locks statistics are kept for unless WithMaxLocks is given.
+const DefaultMaxLocks = 10000
+
+// Durations summarizes wait or hold durations.
+type Durations struct {
+
+	// Count is the number of durations recorded.
+	Count int64
+
+	// Avg is the average of all recorded durations.
+	Avg time.Duration
+
+	// P50, P90 and P99 are percentiles of the most recent SampleSize durations per lock.
+	P50, P90, P99 time.Duration
+
+	// Max is the longest recorded duration.
+	Max time.Duration
+}
+
+// Lock holds the contention statistics of a lock or, for totals, of all locks.
+type Lock struct {
+
+	// Namespace is the namespace of the lock, empty for totals.
+	Namespace string
+
+	// Name is the name of the lock, empty for totals.
+	Name string
+
+	// Acquisitions counts the times the lock was acquired.
+	Acquisitions int64
+
+	// Timeouts counts the requests that gave up waiting because their timeout elapsed.
+	Timeouts int64
+
+	// Cancels counts the requests cancelled by the client while waiting.
+	Cancels int64
+
+	// Releases counts the releases by the holder.
+	Releases int64
+
+	// ForcedReleases counts the releases using a force token.
+	ForcedReleases int64
+
+	// MaxQueue is the largest number of requests waiting for the lock at the same time.
+	MaxQueue int
+
+	// Wait summarizes how long acquisitions waited for the lock.
+	Wait Durations
+
+	// Hold summarizes how long the lock was held until released.
+	Hold Durations
+}
+
+// sample keeps the sum, count and maximum of all durations and the most recent SampleSize durations.
+type sample struct {
+	recent []time.Duration
+	next   int
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// add records d.
+func (s *sample) add(d time.Duration) {
+	s.count++
+	s.sum += d
+	s.max = max(s.max, d)
+	if len(s.recent) < SampleSize {
+		s.recent = append(s.recent, d)
+		return
+	}
+	s.recent[s.next] = d
+	s.next = (s.next + 1) % SampleSize
+}
+
+// merge adds the durations of other to s, keeping all recent durations of both.
+func (s *sample) merge(other *sample) {
+	s.recent = append(s.recent, other.recent...)
+	s.count += other.count
+	s.sum += other.sum
+	s.max = max(s.max, other.max)
+}
+
+// durations summarizes the sample.
+func (s *sample) durations() Durations {
+	d := Durations{Count: s.count, Max: s.max}
+	if s.count == 0 {
+		return d
+	}
+	d.Avg = s.sum / time.Duration(s.count)
+	sorted := slices.Clone(s.recent)
+	slices.Sort(sorted)
+	d.P50, d.P90, d.P99 = percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99)
+	return d
+}
+
+// percentile returns the p-th percentile of the sorted durations using the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// counters accumulates the statistics of a lock.
+type counters struct {
+
+	// mu guards the counters, it is held for a single update or read only.
+	mu sync.Mutex
+
+	// key is the lock counted.
+	key types.Key
+
+	// element is the entry of the lock in the recently used list of the Collector.
+	element *list.Element
+
+	acquisitions, timeouts, cancels, releases, forcedReleases int64
+	maxQueue                                                  int
+	wait, hold                                                sample
+}
+
+// Collector accumulates contention statistics per lock from lock events. It keeps the statistics of a limited
+// number of locks, those of the least recently used lock are dropped first. It is safe for concurrent use.
+type Collector struct {
+
+	// since is the point in time collecting started.
+	since time.Time
+
+	// maxLocks is the number of locks statistics are kept for.
+	maxLocks int
+
+	// mu guards locks and recent.
+	mu sync.Mutex
+
+	// locks holds the counters of the locks an event was recorded for.
+	locks map[types.Key]*counters
+
+	// recent orders the counters of locks from most to least recently used.
+	recent *list.List
+}
+
+// CollectorOption configures a Collector.
+type CollectorOption func(*Collector)
+
+// WithMaxLocks limits the number of locks statistics are kept for, DefaultMaxLocks if n is not positive.
+func WithMaxLocks(n int) CollectorOption {
+	return func(c *Collector) {
+		if n > 0 {
+			c.maxLocks = n
+		}
+	}
+}
+
+// NewCollector creates an empty Collector.
+func NewCollector(opts ...CollectorOption) *Collector {
+	c := &Collector{since: time.Now(), maxLocks: DefaultMaxLocks, locks: make(map[types.Key]*counters), recent: list.New()}
+	for _, opt := range opts {
+		if nil == opt {
+			continue
+		}
+		opt(c)
+	}
+	return c
+}
+
+// Since returns the point in time collecting started.
+func (c *Collector) Since() time.Time {
+	return c.since
+}
+
+// counters returns the counters of key, creating them if needed and dropping those of the least recently used
+// lock when the limit is reached, and marks them as most recently used.
+func (c *Collector) counters(key types.Key) *counters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lc, ok := c.locks[key]; ok {
+		c.recent.MoveToFront(lc.element)
+		return lc
+	}
+	for len(c.locks) >= c.maxLocks {
+		oldest := c.recent.Remove(c.recent.Back()).(*counters)
+		delete(c.locks, oldest.key)
+	}
+	lc := &counters{key: key}
+	lc.element = c.recent.PushFront(lc)
+	c.locks[key] = lc
+	return lc
+}
+
+// Record adds a lock event to the statistics. Releases without a known hold duration, e.g. of locks acquired on
+// another cluster node, are counted but do not contribute to the hold durations.
+func (c *Collector) Record(e history.Event) {
+	lc := c.counters(types.Key{Namespace: e.Namespace, Name: e.Name})
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	switch e.Type {
+	case history.EventAcquire:
+		lc.acquisitions++
+		lc.wait.add(e.Duration)
+	case history.EventTimeout:
+		lc.timeouts++
+	case history.EventCancel:
+		lc.cancels++
+	case history.EventRelease, history.EventForceRelease:
+		if e.Type == history.EventRelease {
+			lc.releases++
+		} else {
+			lc.forcedReleases++
+		}
+		if e.Duration > 0 {
+			lc.hold.add(e.Duration)
+		}
+	}
+}
+
+// Queue reports the number of requests currently waiting for the lock.
+func (c *Collector) Queue(key types.Key, waiting int) {
+	lc := c.counters(key)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.maxQueue = max(lc.maxQueue, waiting)
+}
+
+// Query returns the statistics of all locks for which match returns true, sorted by namespace and name, and their
+// totals. The maximum queue length of the totals is the largest of the selected locks. Events are recorded while
+// querying, each lock is read at once but the locks are not read at the same point in time.
+func (c *Collector) Query(match func(namespace, name string) bool) ([]Lock, Lock) {
+	selected := make([]*counters, 0)
+	c.mu.Lock()
+	for key, lc := range c.locks {
+		if match(key.Namespace, key.Name) {
+			selected = append(selected, lc)
+		}
+	}
+	c.mu.Unlock()
+
+	result := make([]Lock, 0, len(selected))
+	total := counters{}
+	for _, lc := range selected {
+		lc.mu.Lock()
+		result = append(result, lc.lock(lc.key.Namespace, lc.key.Name))
+		total.acquisitions += lc.acquisitions
+		total.timeouts += lc.timeouts
+		total.cancels += lc.cancels
+		total.releases += lc.releases
+		total.forcedReleases += lc.forcedReleases
+		total.maxQueue = max(total.maxQueue, lc.maxQueue)
+		total.wait.merge(&lc.wait)
+		total.hold.merge(&lc.hold)
+		lc.mu.Unlock()
+	}
+	slices.SortFunc(result, func(a, b Lock) int {
+		return cmp.Or(strings.Compare(a.Namespace, b.Namespace), strings.Compare(a.Name, b.Name))
+	})
+	return result, total.lock("", "")
+}
+
+// lock returns the statistics of the counters.
+func (lc *counters) lock(namespace, name string) Lock {
+	return Lock{
+		Namespace:      namespace,
+		Name:           name,
+		Acquisitions:   lc.acquisitions,
+		Timeouts:       lc.timeouts,
+		Cancels:        lc.cancels,
+		Releases:       lc.releases,
+		ForcedReleases: lc.forcedReleases,
+		MaxQueue:       lc.maxQueue,
+		Wait:           lc.wait.durations(),
+		Hold:           lc.hold.durations(),
+	}
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
+)
+
+// all matches every lock.
+func all(string, string) bool { return true }
+
+func TestCollectorDropsLeastRecentlyUsed(t *testing.T) {
+	c := NewCollector(WithMaxLocks(2))
+	c.Record(history.Event{Type: history.EventAcquire, Namespace: "default", Name: "a"})
+	c.Record(history.Event{Type: history.EventAcquire, Namespace: "default", Name: "b"})
+	c.Record(history.Event{Type: history.EventAcquire, Namespace: "default", Name: "a"})
+	c.Record(history.Event{Type: history.EventAcquire, Namespace: "default", Name: "c"})
+
+	locks, total := c.Query(all)
+	if len(locks) != 2 || locks[0].Name != "a" || locks[1].Name != "c" {
+		t.Fatalf("expected statistics of a and c, got %+v", locks)
+	}
+	if locks[0].Acquisitions != 2 || total.Acquisitions != 3 {
+		t.Errorf("expected 2 acquisitions of a and 3 in total, got %d and %d", locks[0].Acquisitions, total.Acquisitions)
+	}
+}
+
+func TestCollectorQueryWhileRecording(t *testing.T) {
+	c := NewCollector()
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 1000 {
+				c.Record(history.Event{Type: history.EventAcquire, Namespace: "default", Name: fmt.Sprintf("lock-%d-%d", i, j%10), Duration: time.Millisecond})
+			}
+		}()
+	}
+	for range 100 {
+		c.Query(all)
+	}
+	wg.Wait()
+	if _, total := c.Query(all); total.Acquisitions != 4000 || total.Wait.Count != 4000 {
+		t.Errorf("expected 4000 acquisitions, got %d with %d waits", total.Acquisitions, total.Wait.Count)
+	}
+}
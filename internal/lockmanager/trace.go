@@ -0,0 +1,47 @@
+package lockmanager
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// lockAttributes returns the span attributes identifying a lock and its owner, followed by extra.
+func lockAttributes(key types.Key, pid int32, addr string, extra ...attribute.KeyValue) []attribute.KeyValue {
+	return append([]attribute.KeyValue{
+		attribute.String("lock.namespace", key.Namespace),
+		attribute.String("lock.name", key.Name),
+		attribute.Int("lock.pid", int(pid)),
+		attribute.String("lock.addr", addr),
+	}, extra...)
+}
+
+// outcome sets the outcome of a lock operation on span, marking the span as failed if err is set.
+func outcome(span trace.Span, result string, err error) {
+	span.SetAttributes(attribute.String("lock.outcome", result))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// backend runs the locker operation op for key within a span named lock.backend.<op>. An existing lock is an
+// expected result of acquiring and does not fail the span.
+func (lm *LockManager) backend(ctx context.Context, op string, key types.Key, fn func(ctx context.Context) error) error {
+	ctx, span := lm.tracer.Start(ctx, "lock.backend."+op, trace.WithAttributes(
+		attribute.String("lock.namespace", key.Namespace),
+		attribute.String("lock.name", key.Name),
+	))
+	defer span.End()
+	err := fn(ctx)
+	if err != nil && !errors.Is(err, types.ErrLockExists) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
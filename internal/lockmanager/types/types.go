@@ -1,6 +1,13 @@
 package types
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultNamespace is the namespace used when a request does not name one.
+const DefaultNamespace = "default"
 
 var (
 	// ErrLockExists is returned when an attempt is made to acquire a lock that already exists and is currently held.
@@ -8,8 +15,34 @@ var (
 
 	// ErrStrangersLock is returned when an attempt is made to release a lock that is either not held by the given PID or does not exist.
 	ErrStrangersLock = errors.New("lock not held by given PID or does not exist")
+
+	// ErrLockTimeout is returned when a lock was not acquired because it stayed held until the timeout elapsed or,
+	// without a timeout, because it was held.
+	ErrLockTimeout = errors.New("timeout waiting for lock")
+
+	// ErrRestoreUnsupported is returned when the active locker is not able to restore its state.
+	ErrRestoreUnsupported = errors.New("locker does not support restoring state")
+
+	// ErrShuttingDown is returned to lock requests rejected or aborted because the server is shutting down.
+	ErrShuttingDown = errors.New("server shutting down")
+
+	// ErrWatchLagged is returned to watchers that did not keep up with the lock events and missed some of them.
+	ErrWatchLagged = errors.New("watch fell behind, events were dropped")
 )
 
+// Waiter describes a lock request waiting for a held lock.
+type Waiter struct {
+
+	// Pid is the process ID of the waiting client.
+	Pid int32
+
+	// Addr is the address of the waiting client.
+	Addr string
+
+	// Since is the point in time the request started waiting.
+	Since time.Time
+}
+
 // LockInfo represents the lock status and the process ID (pid) holding the lock.
 type LockInfo struct {
 
@@ -24,20 +57,49 @@ type LockInfo struct {
 
 	// Name represents the name associated with the lock.
 	Name string
+
+	// Namespace represents the namespace the lock belongs to.
+	Namespace string
+}
+
+// Key identifies a lock by its namespace and name.
+type Key struct {
+
+	// Namespace is the namespace of the lock.
+	Namespace string
+
+	// Name is the name of the lock within its namespace.
+	Name string
+}
+
+// Namespace returns namespace or DefaultNamespace if namespace is empty.
+func Namespace(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
 }
 
 // Locker interface defines methods for acquiring and releasing locks.
+// All methods receive the context of the originating request and should give up once it is done.
 type Locker interface {
 
-	// Lock attempts to acquire a lock identified by the given name and associated with the provided process ID (pid).
-	Lock(name string, pid int32, addr string) error
+	// Lock attempts to acquire a lock identified by the given namespace and name and associated with the provided process ID (pid).
+	Lock(ctx context.Context, namespace, name string, pid int32, addr string) error
 
-	// Unlock releases the lock identified by the given name and associated with the provided process ID (pid). Returns an error if the unlock operation fails.
-	Unlock(name string, pid int32, addr string) error
+	// Unlock releases the lock identified by the given namespace and name and associated with the provided process ID (pid). Returns an error if the unlock operation fails.
+	Unlock(ctx context.Context, namespace, name string, pid int32, addr string) error
+
+	// UnlockByName releases the lock identified by the given namespace and name. Returns an error if the unlock operation fails.
+	UnlockByName(ctx context.Context, namespace, name string) error
+
+	// GetLocks returns a slice of LockInfo representing all the current locks of all namespaces and their statuses.
+	GetLocks(ctx context.Context) []LockInfo
+}
 
-	// UnlockByName releases the lock identified by the given name. Returns an error if the unlock operation fails.
-	UnlockByName(name string) error
+// Restorer is implemented by lockers able to replace their complete state, e.g. when loading a snapshot.
+type Restorer interface {
 
-	// GetLocks returns a slice of LockInfo representing all the current locks and their statuses.
-	GetLocks() []LockInfo
+	// Restore replaces all current locks with the given locks.
+	Restore(ctx context.Context, locks []LockInfo) error
 }
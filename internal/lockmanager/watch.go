@@ -0,0 +1,66 @@
+package lockmanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
+)
+
+// watchBuffer is the number of events buffered for a watcher before it is considered too slow and dropped.
+const watchBuffer = 256
+
+// watcher is a subscriber of lock events.
+type watcher struct {
+
+	// filter selects the events passed to the watcher.
+	filter history.Filter
+
+	// events receives the matching events.
+	events chan history.Event
+}
+
+// Watch returns a channel receiving every event matching f recorded from now on. Since and Until of f are ignored.
+// The channel is closed once ctx is done or if the receiver does not keep up with the events, in which case
+// events were lost and types.ErrWatchLagged should be reported.
+func (lm *LockManager) Watch(ctx context.Context, f history.Filter) <-chan history.Event {
+	f.Since, f.Until = time.Time{}, time.Time{}
+	w := &watcher{filter: f, events: make(chan history.Event, watchBuffer)}
+	lm.watchMu.Lock()
+	lm.watchers[w] = struct{}{}
+	lm.watchMu.Unlock()
+	go func() {
+		<-ctx.Done()
+		lm.unwatch(w)
+	}()
+	return w.events
+}
+
+// unwatch removes a watcher and closes its channel, unless that already happened.
+func (lm *LockManager) unwatch(w *watcher) {
+	lm.watchMu.Lock()
+	defer lm.watchMu.Unlock()
+	if _, ok := lm.watchers[w]; !ok {
+		return
+	}
+	delete(lm.watchers, w)
+	close(w.events)
+}
+
+// notify passes an event to all watchers whose filter matches. Watchers with a full buffer are dropped instead of
+// blocking the lock operation.
+func (lm *LockManager) notify(e history.Event) {
+	lm.watchMu.Lock()
+	defer lm.watchMu.Unlock()
+	for w := range lm.watchers {
+		if !w.filter.Matches(e) {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			delete(lm.watchers, w)
+			close(w.events)
+		}
+	}
+}
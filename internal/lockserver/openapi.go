@@ -0,0 +1,8 @@
+package lockserver
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI document of the HTTP/JSON gateway, generated from lockserver.proto and lockserver_http.yaml.
+//
+//go:embed lockserver.swagger.json
+var OpenAPI []byte
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+
+	// FormatText writes records as key=value pairs.
+	FormatText = "text"
+
+	// FormatJSON writes records as JSON objects, one per line.
+	FormatJSON = "json"
+)
+
+// New creates a logger writing records at or above level to w in the given format, FormatText or FormatJSON.
+// Changing level later changes the records written.
+func New(w io.Writer, format string, level *slog.LevelVar) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected text or json", format)
+}
+
+// ParseLevel parses one of debug, info, warn or error.
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return l, err
+		}
+		return l, nil
+	}
+	return l, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+}
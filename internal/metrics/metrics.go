@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// namespace is the prefix of all metric names.
+const namespace = "lockd"
+
+// Metrics holds the Prometheus collectors of lockd. All methods may be called on a nil *Metrics, doing nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	events     *prometheus.CounterVec
+	waitTime   *prometheus.HistogramVec
+	holdTime   *prometheus.HistogramVec
+	waiters    *prometheus.GaugeVec
+	rejections *prometheus.CounterVec
+	rpcLatency *prometheus.HistogramVec
+
+	// mu guards waiting.
+	mu sync.Mutex
+
+	// waiting counts the waiters per lock, used to remove the gauge of a lock once nobody waits for it.
+	waiting map[types.Key]int
+}
+
+// New creates Metrics registered in a dedicated registry, including Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lock_events_total",
+			Help:      "Lock events by type: queued, acquire, release, force-release, timeout and cancel.",
+		}, []string{"namespace", "type"}),
+		waitTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "lock_wait_seconds",
+			Help:      "Time lock requests waited, by outcome: acquire, timeout or cancel.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"namespace", "outcome"}),
+		holdTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "lock_hold_seconds",
+			Help:      "Time locks were held until released or force released.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"namespace"}),
+		waiters: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "lock_waiters",
+			Help:      "Lock requests currently waiting per lock.",
+		}, []string{"namespace", "lock"}),
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lock_rejections_total",
+			Help:      "Lock requests rejected before waiting, by reason: permission, quota or shutdown.",
+		}, []string{"namespace", "reason"}),
+		rpcLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Duration of gRPC calls by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		waiting: make(map[types.Key]int),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.events, m.waitTime, m.holdTime, m.waiters, m.rejections, m.rpcLatency,
+	)
+	return m
+}
+
+// Handler returns the HTTP handler exposing the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Event records a lock event. For acquire, timeout and cancel events duration is the time waited, for
+// release and force-release events the time the lock was held.
+func (m *Metrics) Event(eventType history.EventType, namespace string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.events.WithLabelValues(namespace, string(eventType)).Inc()
+	switch eventType {
+	case history.EventAcquire, history.EventTimeout, history.EventCancel:
+		m.waitTime.WithLabelValues(namespace, string(eventType)).Observe(duration.Seconds())
+	case history.EventRelease, history.EventForceRelease:
+		m.holdTime.WithLabelValues(namespace).Observe(duration.Seconds())
+	}
+}
+
+// Waiting adjusts the number of requests waiting for a lock by delta.
+func (m *Metrics) Waiting(namespace, name string, delta int) {
+	if m == nil {
+		return
+	}
+	key := types.Key{Namespace: namespace, Name: name}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waiting[key] += delta
+	if m.waiting[key] <= 0 {
+		delete(m.waiting, key)
+		m.waiters.DeleteLabelValues(namespace, name)
+		return
+	}
+	m.waiters.WithLabelValues(namespace, name).Set(float64(m.waiting[key]))
+}
+
+// Rejected counts a lock request rejected for reason.
+func (m *Metrics) Rejected(namespace, reason string) {
+	if m == nil {
+		return
+	}
+	m.rejections.WithLabelValues(namespace, reason).Inc()
+}
+
+// RPC records the duration of a gRPC call.
+func (m *Metrics) RPC(method, code string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rpcLatency.WithLabelValues(method, code).Observe(duration.Seconds())
+}
@@ -0,0 +1,108 @@
+package peercred
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// authType is the name reported by Info.AuthType.
+const authType = "peercred"
+
+// Info holds the credentials of the process on the other end of a Unix socket, as reported by the kernel.
+// It implements credentials.AuthInfo.
+type Info struct {
+	credentials.CommonAuthInfo
+
+	// PID is the process ID of the peer.
+	PID int32
+
+	// UID is the user ID of the peer.
+	UID uint32
+
+	// GID is the group ID of the peer.
+	GID uint32
+}
+
+// AuthType implements credentials.AuthInfo.
+func (i Info) AuthType() string {
+	return authType
+}
+
+// Identity returns the owner identity of the peer, derived from its user ID.
+func (i Info) Identity() string {
+	return fmt.Sprintf("uid:%d", i.UID)
+}
+
+// Owns reports whether pid is the peer process itself or its parent. Clients like the lock command send the pid
+// of their parent shell, every other pid is not trusted.
+func (i Info) Owns(pid int32) bool {
+	if pid == i.PID {
+		return true
+	}
+	parent, err := parentPID(i.PID)
+	return err == nil && parent == pid
+}
+
+// creds are transport credentials reading the peer credentials of Unix socket connections. Connections are
+// not encrypted.
+type creds struct{}
+
+// NewCredentials returns transport credentials attaching Info to every Unix socket connection accepted by
+// a gRPC server. Connections of other types and platforms without peer credentials carry no Info.
+func NewCredentials() credentials.TransportCredentials {
+	return creds{}
+}
+
+// ClientHandshake implements credentials.TransportCredentials, it does not alter the connection.
+func (creds) ClientHandshake(_ context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, unauthenticated(), nil
+}
+
+// ServerHandshake implements credentials.TransportCredentials, reading the peer credentials of Unix connections.
+func (creds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, unauthenticated(), nil
+	}
+	info, err := lookup(unixConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info == nil {
+		return conn, unauthenticated(), nil
+	}
+	return conn, *info, nil
+}
+
+// Info implements credentials.TransportCredentials.
+func (creds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: authType}
+}
+
+// Clone implements credentials.TransportCredentials.
+func (c creds) Clone() credentials.TransportCredentials {
+	return c
+}
+
+// OverrideServerName implements credentials.TransportCredentials.
+func (creds) OverrideServerName(string) error {
+	return nil
+}
+
+// unauthenticatedInfo is the AuthInfo of connections without peer credentials.
+type unauthenticatedInfo struct {
+	credentials.CommonAuthInfo
+}
+
+// AuthType implements credentials.AuthInfo.
+func (unauthenticatedInfo) AuthType() string {
+	return "insecure"
+}
+
+// unauthenticated returns the AuthInfo of connections without peer credentials.
+func unauthenticated() credentials.AuthInfo {
+	return unauthenticatedInfo{credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package peercred
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// lookup reads the peer credentials of conn using SO_PEERCRED.
+func lookup(conn *net.UnixConn) (*Info, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	return &Info{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity},
+		PID:            cred.Pid,
+		UID:            cred.Uid,
+		GID:            cred.Gid,
+	}, nil
+}
+
+// parentPID returns the parent process ID of pid from /proc.
+func parentPID(pid int32) (int32, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// the command name in parentheses may contain spaces, the fields after it are well defined
+	stat := string(data)
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	var (
+		state string
+		ppid  int32
+	)
+	if _, err := fmt.Sscanf(stat[end+1:], " %s %d", &state, &ppid); err != nil {
+		return 0, err
+	}
+	return ppid, nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package peercred
+
+import (
+	"errors"
+	"net"
+)
+
+// lookup returns no Info as peer credentials are only supported on Linux.
+func lookup(_ *net.UnixConn) (*Info, error) {
+	return nil, nil
+}
+
+// parentPID is not supported on this platform.
+func parentPID(_ int32) (int32, error) {
+	return 0, errors.New("parent pid lookup not supported")
+}
@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/sascha-andres/lockutil/internal/auth"
+)
+
+// Policy restricts lock requests for locks matching a namespace and name pattern.
+type Policy struct {
+
+	// Namespace is the namespace pattern, * or empty for all namespaces.
+	Namespace string
+
+	// Pattern is the lock name pattern, * matches any sequence of characters and ? a single character.
+	Pattern string
+
+	// MaxTimeoutSeconds caps the wait timeout of lock requests, 0 for no cap.
+	MaxTimeoutSeconds int32
+
+	// Frozen rejects new lock requests, held locks can still be released.
+	Frozen bool
+}
+
+// Matches reports whether the policy applies to the lock with the given namespace and name.
+func (p Policy) Matches(namespace, name string) bool {
+	return (p.Namespace == "" || auth.Match(p.Namespace, namespace)) && auth.Match(p.Pattern, name)
+}
+
+// validate checks that the policy has a pattern and a valid timeout cap.
+func (p Policy) validate() error {
+	if p.Pattern == "" {
+		return errors.New("policy requires a lock name pattern")
+	}
+	if p.MaxTimeoutSeconds < 0 {
+		return errors.New("max timeout must not be negative")
+	}
+	return nil
+}
+
+// same reports whether p and other apply to the same namespace and name patterns.
+func (p Policy) same(other Policy) bool {
+	return p.Namespace == other.Namespace && p.Pattern == other.Pattern
+}
+
+// Set holds the policies of a lockd node. The first policy matching a lock applies.
+type Set struct {
+	mu       sync.RWMutex
+	policies []Policy
+}
+
+// NewSet creates an empty Set.
+func NewSet() *Set {
+	return &Set{policies: make([]Policy, 0)}
+}
+
+// Put replaces the policy with the same namespace and pattern or appends p.
+func (s *Set) Put(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(p)
+	return nil
+}
+
+// put replaces the policy with the same namespace and pattern or appends p. s.mu must be held.
+func (s *Set) put(p Policy) {
+	if i := slices.IndexFunc(s.policies, p.same); i >= 0 {
+		s.policies[i] = p
+		return
+	}
+	s.policies = append(s.policies, p)
+}
+
+// Remove removes the policy with the same namespace and pattern as p, reporting whether one existed.
+func (s *Set) Remove(p Policy) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.policies, p.same)
+	if i < 0 {
+		return false
+	}
+	s.policies = slices.Delete(s.policies, i, i+1)
+	return true
+}
+
+// Replace removes the policies in previous and puts those in current as one change, e.g. when reloading the
+// policies of a configuration file. Other policies are kept. Nothing is changed if a policy in current is invalid.
+func (s *Set) Replace(previous, current []Policy) error {
+	for _, p := range current {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range previous {
+		s.policies = slices.DeleteFunc(s.policies, p.same)
+	}
+	for _, p := range current {
+		s.put(p)
+	}
+	return nil
+}
+
+// Match returns the first policy applying to the lock, false if there is none.
+func (s *Set) Match(namespace, name string) (Policy, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.policies {
+		if p.Matches(namespace, name) {
+			return p, true
+		}
+	}
+	return Policy{}, false
+}
+
+// List returns all policies in the order they are matched.
+func (s *Set) List() []Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.policies)
+}
@@ -0,0 +1,205 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// Limits configures the maximum resources a client or namespace may use, a value of 0 disables the limit.
+type Limits struct {
+
+	// HeldPerClient is the maximum number of locks a single client principal may hold.
+	HeldPerClient int
+
+	// HeldPerNamespace is the maximum number of locks held within a namespace.
+	HeldPerNamespace int
+
+	// WaitingPerClient is the maximum number of lock requests a single client principal may have queued.
+	WaitingPerClient int
+
+	// WaitingPerNamespace is the maximum number of lock requests queued within a namespace.
+	WaitingPerNamespace int
+}
+
+// Enabled reports whether any limit is set.
+func (l Limits) Enabled() bool {
+	return l.HeldPerClient > 0 || l.HeldPerNamespace > 0 || l.WaitingPerClient > 0 || l.WaitingPerNamespace > 0
+}
+
+// ExceededError is returned when a request would exceed a limit.
+type ExceededError struct {
+
+	// Resource is the exhausted resource, "held locks" or "waiting requests".
+	Resource string
+
+	// Scope describes whose limit is exhausted, e.g. client "team-a" or namespace "default".
+	Scope string
+
+	// Limit is the configured maximum.
+	Limit int
+}
+
+// Error implements the error interface.
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s reached the limit of %d %s", e.Scope, e.Limit, e.Resource)
+}
+
+// holder remembers which client acquired a lock and the owner address it was acquired with.
+type holder struct {
+	client string
+	addr   string
+
+	// generation is the value of Tracker.generation when the lock was acquired.
+	generation uint64
+}
+
+// Tracker counts held locks and waiting requests per client and namespace and enforces Limits.
+// Held locks are counted from the lock state passed to Begin, so locks released elsewhere, e.g. by a
+// forced release or on another cluster node, stop counting without the tracker being told. Every waiting request
+// reserves a held lock, so concurrent requests of one client cannot exceed the held limits together.
+type Tracker struct {
+	mu                sync.Mutex
+	limits            Limits
+	holders           map[types.Key]holder
+	generation        uint64
+	reservedClient    map[string]int
+	reservedNamespace map[string]int
+	waitingClient     map[string]int
+	waitingNamespace  map[string]int
+}
+
+// Request is a lock request admitted by Begin.
+type Request struct {
+	tracker   *Tracker
+	client    string
+	namespace string
+	done      bool
+}
+
+// NewTracker creates a Tracker enforcing limits.
+func NewTracker(limits Limits) *Tracker {
+	return &Tracker{
+		limits:            limits,
+		holders:           make(map[types.Key]holder),
+		reservedClient:    make(map[string]int),
+		reservedNamespace: make(map[string]int),
+		waitingClient:     make(map[string]int),
+		waitingNamespace:  make(map[string]int),
+	}
+}
+
+// SetLimits replaces the enforced limits, e.g. after reloading the configuration. While no limit is set nothing
+// is tracked, so locks acquired during that time do not count towards client limits set later.
+func (t *Tracker) SetLimits(limits Limits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+}
+
+// Begin checks the limits for a new lock request of client in namespace against the current lock state returned
+// by locks, registers the request as waiting and reserves a held lock for it. locks is called without holding
+// the tracker's mutex. Done must be called on the returned request once it finished.
+func (t *Tracker) Begin(client, namespace string, locks func() []types.LockInfo) (*Request, error) {
+	t.mu.Lock()
+	limits, generation := t.limits, t.generation
+	t.mu.Unlock()
+	if !limits.Enabled() {
+		return &Request{}, nil
+	}
+	current := make([]types.LockInfo, 0)
+	if limits.HeldPerClient > 0 || limits.HeldPerNamespace > 0 {
+		current = locks()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held := make(map[types.Key]string)
+	namespaceHeld := 0
+	for _, lock := range current {
+		if !lock.IsLocked {
+			continue
+		}
+		held[types.Key{Namespace: lock.Namespace, Name: lock.Name}] = lock.Addr
+		if lock.Namespace == namespace {
+			namespaceHeld++
+		}
+	}
+	clientHeld := 0
+	for key, h := range t.holders {
+		// locks acquired after the state was read are kept, they are missing from it
+		if addr, ok := held[key]; h.generation <= generation && (!ok || addr != h.addr) {
+			delete(t.holders, key)
+			continue
+		}
+		if h.client == client {
+			clientHeld++
+		}
+	}
+	clientHeld += t.reservedClient[client]
+	namespaceHeld += t.reservedNamespace[namespace]
+
+	if t.limits.HeldPerClient > 0 && clientHeld >= t.limits.HeldPerClient {
+		return nil, &ExceededError{Resource: "held locks", Scope: fmt.Sprintf("client %q", client), Limit: t.limits.HeldPerClient}
+	}
+	if t.limits.HeldPerNamespace > 0 && namespaceHeld >= t.limits.HeldPerNamespace {
+		return nil, &ExceededError{Resource: "held locks", Scope: fmt.Sprintf("namespace %q", namespace), Limit: t.limits.HeldPerNamespace}
+	}
+	if t.limits.WaitingPerClient > 0 && t.waitingClient[client] >= t.limits.WaitingPerClient {
+		return nil, &ExceededError{Resource: "waiting requests", Scope: fmt.Sprintf("client %q", client), Limit: t.limits.WaitingPerClient}
+	}
+	if t.limits.WaitingPerNamespace > 0 && t.waitingNamespace[namespace] >= t.limits.WaitingPerNamespace {
+		return nil, &ExceededError{Resource: "waiting requests", Scope: fmt.Sprintf("namespace %q", namespace), Limit: t.limits.WaitingPerNamespace}
+	}
+
+	t.reservedClient[client]++
+	t.reservedNamespace[namespace]++
+	t.waitingClient[client]++
+	t.waitingNamespace[namespace]++
+	return &Request{tracker: t, client: client, namespace: namespace}, nil
+}
+
+// Acquired records that the client of the request now holds the lock with the given owner address, the reserved
+// held lock becomes that lock.
+func (r *Request) Acquired(name, addr string) {
+	if r.tracker == nil {
+		return
+	}
+	t := r.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	decrement(t.reservedClient, r.client)
+	decrement(t.reservedNamespace, r.namespace)
+	t.generation++
+	t.holders[types.Key{Namespace: r.namespace, Name: name}] = holder{client: r.client, addr: addr, generation: t.generation}
+}
+
+// Done finishes the request, it no longer counts as waiting and a reservation not used by Acquired is given back.
+func (r *Request) Done() {
+	if r.tracker == nil {
+		return
+	}
+	t := r.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	decrement(t.waitingClient, r.client)
+	decrement(t.waitingNamespace, r.namespace)
+	if !r.done {
+		r.done = true
+		decrement(t.reservedClient, r.client)
+		decrement(t.reservedNamespace, r.namespace)
+	}
+}
+
+// decrement lowers a counter and removes it once it reaches zero.
+func decrement(counters map[string]int, key string) {
+	counters[key]--
+	if counters[key] <= 0 {
+		delete(counters, key)
+	}
+}
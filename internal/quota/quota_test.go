@@ -0,0 +1,45 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+)
+
+// noLocks is a lock state without held locks.
+func noLocks() []types.LockInfo {
+	return nil
+}
+
+func TestBeginReservesHeldLocks(t *testing.T) {
+	tracker := NewTracker(Limits{HeldPerClient: 1})
+	var exceeded *ExceededError
+
+	first, err := tracker.Begin("client", types.DefaultNamespace, noLocks)
+	if err != nil {
+		t.Fatalf("beginning first request: %v", err)
+	}
+	// a concurrent request is rejected while the first one may still acquire its lock
+	if _, err := tracker.Begin("client", types.DefaultNamespace, noLocks); !errors.As(err, &exceeded) {
+		t.Fatalf("expected concurrent request to exceed the limit, got %v", err)
+	}
+	first.Done()
+
+	second, err := tracker.Begin("client", types.DefaultNamespace, noLocks)
+	if err != nil {
+		t.Fatalf("expected the reservation of a failed request to be given back, got %v", err)
+	}
+	second.Acquired("db", "addr")
+	second.Done()
+	held := func() []types.LockInfo {
+		return []types.LockInfo{{Namespace: types.DefaultNamespace, Name: "db", Addr: "addr", IsLocked: true}}
+	}
+	if _, err := tracker.Begin("client", types.DefaultNamespace, held); !errors.As(err, &exceeded) {
+		t.Fatalf("expected held lock to count towards the limit, got %v", err)
+	}
+	// once released elsewhere the lock stops counting
+	if _, err := tracker.Begin("client", types.DefaultNamespace, noLocks); err != nil {
+		t.Fatalf("expected released lock not to count, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+
+	// ExporterNone disables tracing.
+	ExporterNone = "none"
+
+	// ExporterOTLP sends spans to an OTLP collector using gRPC.
+	ExporterOTLP = "otlp"
+
+	// ExporterStdout writes spans as JSON to stdout or a file, meant for local testing.
+	ExporterStdout = "stdout"
+)
+
+// Name is the instrumentation name of the spans created by lockutil.
+const Name = "github.com/sascha-andres/lockutil"
+
+// Propagator carries the trace context between lockutil clients and lockd using W3C trace context and baggage.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Config selects the exporter of a tracer provider.
+type Config struct {
+
+	// ServiceName is reported as service.name of all spans.
+	ServiceName string
+
+	// Exporter is one of ExporterNone, ExporterOTLP or ExporterStdout.
+	Exporter string
+
+	// Endpoint is the host:port of the OTLP collector, empty to use OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317.
+	Endpoint string
+
+	// Insecure connects to the OTLP collector without TLS.
+	Insecure bool
+
+	// File is the file the stdout exporter appends to, empty for stdout.
+	File string
+}
+
+// NewProvider creates a tracer provider exporting spans as configured. The returned function flushes pending
+// spans and releases the exporter, it must be called on shutdown. ExporterNone returns a no-op provider.
+func NewProvider(ctx context.Context, cfg Config) (trace.TracerProvider, func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	closeFile := func() error { return nil }
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := make([]otlptracegrpc.Option, 0)
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		e, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter = e
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if cfg.File != "" {
+			f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, nil, err
+			}
+			w = f
+			closeFile = f.Close
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter = e
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q, expected none, otlp or stdout", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	shutdown := func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeErr := closeFile(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return tp, shutdown, nil
+}
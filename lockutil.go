@@ -4,13 +4,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/sascha-andres/lockutil/internal/auth"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
 	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+	"github.com/sascha-andres/lockutil/internal/tlsconfig"
+	"github.com/sascha-andres/lockutil/internal/tracing"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Client represents a client connection to a remote server with specified host and port.
@@ -22,11 +36,57 @@ type Client struct {
 	// host specifies the hostname or IP address for the client connection to the remote server.
 	host string
 
+	// addresses lists the nodes of a lockd cluster, when set host and port are ignored.
+	addresses []string
+
+	// useTLS enables TLS for the connection.
+	useTLS bool
+
+	// caFile is the PEM file with the CA certificates used to verify the server, empty to use the system roots.
+	caFile string
+
+	// certFile is the PEM file with the client certificate presented to the server.
+	certFile string
+
+	// keyFile is the PEM file with the key of the client certificate.
+	keyFile string
+
+	// token is sent as bearer token with every call, empty to not authenticate.
+	token string
+
+	// namespace is the namespace all locks of the client belong to, empty for the default namespace.
+	namespace string
+
+	// tracerProvider creates the client spans of all calls, nil to use the global provider.
+	tracerProvider trace.TracerProvider
+
 	// conn represents the underlying gRPC client connection used for remote procedure calls.
 	conn *grpc.ClientConn
 
 	// client is the gRPC client for interacting with the LockService.
 	client pb.LockServiceClient
+
+	// admin is the gRPC client for the operator-only AdminService.
+	admin pb.AdminServiceClient
+
+	// health is the gRPC client for the standard health service of lockd.
+	health healthpb.HealthClient
+}
+
+// ErrShuttingDown is returned by Acquire when lockd rejects or aborts the request because it is shutting down.
+// The lock was not acquired, retrying against another node or after a restart is safe.
+var ErrShuttingDown = types.ErrShuttingDown
+
+// QuotaError is returned when lockd rejects a lock request because a quota of the client or namespace is exhausted.
+type QuotaError struct {
+
+	// Message describes the exhausted quota.
+	Message string
+}
+
+// Error implements the error interface.
+func (e *QuotaError) Error() string {
+	return e.Message
 }
 
 // ClientOption defines a function type that modifies some aspect of a Client during its creation.
@@ -46,6 +106,54 @@ type LockInfo struct {
 
 	// Name represents the name associated with the lock.
 	Name string
+
+	// Namespace represents the namespace the lock belongs to.
+	Namespace string
+
+	// Since is the point in time the lock was acquired, the zero time if the serving node does not know it.
+	Since time.Time
+
+	// Waiters are the requests waiting for the lock on the serving node, longest waiting first.
+	Waiters []Waiter
+}
+
+// Waiter describes a request waiting for a lock.
+type Waiter struct {
+
+	// Pid is the process ID of the waiting client.
+	Pid int32
+
+	// Addr is the address of the waiting client.
+	Addr string
+
+	// Since is the point in time the request started waiting.
+	Since time.Time
+}
+
+// HistoryEvent describes a recorded change of a lock.
+type HistoryEvent struct {
+
+	// Time is the point in time the event happened.
+	Time time.Time
+
+	// Type is the kind of event: queued, acquire, release, force-release, timeout or cancel.
+	Type string
+
+	// Name is the name of the lock.
+	Name string
+
+	// Namespace is the namespace of the lock.
+	Namespace string
+
+	// Pid is the process ID of the client causing the event.
+	Pid int32
+
+	// Addr is the address of the client causing the event.
+	Addr string
+
+	// Duration is the time waited for acquire, timeout and cancel events and the time the lock was held for releases,
+	// 0 for queued events.
+	Duration time.Duration
 }
 
 // WithHost returns a ClientOption to set the host field of a Client.
@@ -56,6 +164,18 @@ func WithHost(host string) ClientOption {
 	}
 }
 
+// WithSocket connects to lockd listening on the Unix socket at path instead of host and port.
+// Passing a host starting with unix: to WithHost has the same effect.
+func WithSocket(path string) ClientOption {
+	return func(c *Client) error {
+		if path == "" {
+			return errors.New("socket path is required")
+		}
+		c.host = "unix:" + path
+		return nil
+	}
+}
+
 // WithPort sets the port for the Client.
 func WithPort(port string) ClientOption {
 	return func(c *Client) error {
@@ -64,7 +184,72 @@ func WithPort(port string) ClientOption {
 	}
 }
 
+// WithAddresses sets the host:port addresses of several lockd cluster nodes. The Client connects to the
+// first reachable node and fails over to the next one if the connection breaks.
+func WithAddresses(addresses ...string) ClientOption {
+	return func(c *Client) error {
+		if len(addresses) == 0 {
+			return errors.New("at least one address is required")
+		}
+		c.addresses = addresses
+		return nil
+	}
+}
+
+// WithTLS enables TLS for the connection. The server certificate is verified against the CA certificates
+// in caFile, or against the system roots if caFile is empty.
+func WithTLS(caFile string) ClientOption {
+	return func(c *Client) error {
+		c.useTLS = true
+		c.caFile = caFile
+		return nil
+	}
+}
+
+// WithClientCertificate enables TLS and presents the given client certificate to the server. With mutual TLS
+// the subject of the certificate is used as the owner identity of acquired locks.
+func WithClientCertificate(certFile, keyFile string) ClientOption {
+	return func(c *Client) error {
+		if certFile == "" || keyFile == "" {
+			return errors.New("certificate and key are required")
+		}
+		c.useTLS = true
+		c.certFile = certFile
+		c.keyFile = keyFile
+		return nil
+	}
+}
+
+// WithToken authenticates all calls with the given bearer token. The token is sent in clear text
+// unless TLS is enabled.
+func WithToken(token string) ClientOption {
+	return func(c *Client) error {
+		c.token = token
+		return nil
+	}
+}
+
+// WithNamespace sets the namespace of all locks acquired, released, listed or queried by the client.
+// Locks with the same name in different namespaces are independent.
+func WithNamespace(namespace string) ClientOption {
+	return func(c *Client) error {
+		c.namespace = namespace
+		return nil
+	}
+}
+
+// WithTracerProvider creates the client spans of all calls using tp instead of the global tracer provider.
+// The trace context of the context passed to a call is sent to lockd in any case, lockd creates its spans for
+// waiting, releasing and the backend as children of it.
+func WithTracerProvider(tp trace.TracerProvider) ClientOption {
+	return func(c *Client) error {
+		c.tracerProvider = tp
+		return nil
+	}
+}
+
 // NewClient creates a new Client instance with optional configuration via ClientOption. Defaults to host 127.0.0.1 and port 50051.
+// Hosts of the form unix:/path/to/socket or unix:///path/to/socket connect to a Unix socket, the port is ignored.
 func NewClient(opts ...ClientOption) (*Client, error) {
 	c := &Client{
 		host: "127.0.0.1",
@@ -78,12 +263,41 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 			return nil, err
 		}
 	}
-	conn, err := grpc.NewClient(fmt.Sprintf("%s:%s", c.host, c.port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	target := c.String()
+	creds := insecure.NewCredentials()
+	if c.useTLS {
+		tlsConfig, err := tlsconfig.Client(c.caFile, c.certFile, c.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	traceOptions := []otelgrpc.Option{otelgrpc.WithPropagators(tracing.Propagator)}
+	if c.tracerProvider != nil {
+		traceOptions = append(traceOptions, otelgrpc.WithTracerProvider(c.tracerProvider))
+	}
+	dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithStatsHandler(otelgrpc.NewClientHandler(traceOptions...))}
+	if c.token != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(auth.BearerToken{Token: c.token, RequireTLS: c.useTLS}))
+	}
+	if len(c.addresses) > 0 {
+		r := manual.NewBuilderWithScheme("lockutil")
+		state := resolver.State{Addresses: make([]resolver.Address, 0, len(c.addresses))}
+		for _, addr := range c.addresses {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		r.InitialState(state)
+		target = "lockutil:///cluster"
+		dialOptions = append(dialOptions, grpc.WithResolvers(r))
+	}
+	conn, err := grpc.NewClient(target, dialOptions...)
 	if err != nil {
-		log.Fatalf("failed to connect: %v", err)
+		return nil, err
 	}
 	c.conn = conn
 	c.client = pb.NewLockServiceClient(conn)
+	c.admin = pb.NewAdminServiceClient(conn)
+	c.health = healthpb.NewHealthClient(conn)
 	return c, nil
 }
 
@@ -94,18 +308,50 @@ func (c *Client) Close() error {
 
 // String returns the connection details of the Client by concatenating the host and port.
 func (c *Client) String() string {
+	if len(c.addresses) > 0 {
+		return strings.Join(c.addresses, ",")
+	}
+	if strings.HasPrefix(c.host, "unix:") {
+		return c.host
+	}
 	return c.host + ":" + c.port
 }
 
+// Ping checks that lockd is up and serving the LockService. It returns an error if lockd cannot be reached
+// or reports that it is not serving, e.g. while shutting down or while a cluster has no leader.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{Service: pb.LockService_ServiceDesc.ServiceName})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("lockd is %s", resp.GetStatus())
+	}
+	return nil
+}
+
 // Acquire sends a lock request to the lock service with a specified lock name and timeout.
 func (c *Client) Acquire(lockName string, timeout int32) error {
+	return c.AcquireContext(context.Background(), lockName, timeout)
+}
+
+// AcquireContext sends a lock request to the lock service with a specified lock name and timeout.
+// Cancelling ctx stops waiting for the lock, the server removes the waiter immediately.
+func (c *Client) AcquireContext(ctx context.Context, lockName string, timeout int32) error {
 	req := &pb.LockRequest{
 		LockName:       lockName,
 		TimeoutSeconds: timeout,
 		Pid:            int32(os.Getppid()),
+		Namespace:      c.namespace,
 	}
-	resp, err := c.client.RequestLock(context.Background(), req)
+	resp, err := c.client.RequestLock(ctx, req)
 	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.ResourceExhausted {
+			return &QuotaError{Message: st.Message()}
+		}
+		if st, ok := status.FromError(err); ok && st.Code() == codes.Unavailable && st.Message() == ErrShuttingDown.Error() {
+			return ErrShuttingDown
+		}
 		return err
 	}
 	if !resp.Success {
@@ -118,10 +364,15 @@ func (c *Client) Acquire(lockName string, timeout int32) error {
 // If force is true, the forceToken must be provided to force the release.
 // Returns an error if the release operation fails.
 func (c *Client) Release(lockName, forceToken string, force bool) error {
+	return c.ReleaseContext(context.Background(), lockName, forceToken, force)
+}
+
+// ReleaseContext releases a lock with the given lock name like Release, passing the trace context of ctx to lockd.
+func (c *Client) ReleaseContext(ctx context.Context, lockName, forceToken string, force bool) error {
 	if force && forceToken == "" {
 		return errors.New("force token is required")
 	}
-	releaseResp, err := c.client.ReleaseLock(context.Background(), &pb.ReleaseRequest{LockName: lockName, Pid: int32(os.Getppid()), ForceToken: &forceToken})
+	releaseResp, err := c.client.ReleaseLock(ctx, &pb.ReleaseRequest{LockName: lockName, Pid: int32(os.Getppid()), ForceToken: &forceToken, Namespace: c.namespace})
 	if err != nil {
 		return err
 	}
@@ -131,23 +382,160 @@ func (c *Client) Release(lockName, forceToken string, force bool) error {
 	return nil
 }
 
-// List retrieves and prints a list of locks from the LockServiceClient.
+// List retrieves the locks of the namespace of the client from the LockServiceClient.
 func (c *Client) List() ([]LockInfo, error) {
-	locks, err := c.client.List(context.Background(), &pb.ListRequest{})
+	return c.list(&pb.ListRequest{Namespace: c.namespace})
+}
+
+// ListAllNamespaces retrieves the locks of all namespaces from the LockServiceClient.
+func (c *Client) ListAllNamespaces() ([]LockInfo, error) {
+	return c.list(&pb.ListRequest{AllNamespaces: true})
+}
+
+// list retrieves the locks selected by the request.
+func (c *Client) list(req *pb.ListRequest) ([]LockInfo, error) {
+	locks, err := c.client.List(context.Background(), req)
 	if err != nil {
 		return nil, err
 	}
-	l := make([]LockInfo, 0)
-	for _, lock := range locks.GetLocks() {
+	return lockInfos(locks.GetLocks()), nil
+}
+
+// lockInfos converts the locks returned by lockd.
+func lockInfos(locks []*pb.Lock) []LockInfo {
+	l := make([]LockInfo, 0, len(locks))
+	for _, lock := range locks {
 		if lock == nil {
 			continue
 		}
-		l = append(l, LockInfo{
-			Pid:      lock.GetPid(),
-			Addr:     lock.GetAddr(),
-			IsLocked: lock.GetLocked(),
-			Name:     lock.GetName(),
-		})
-	}
-	return l, nil
+		info := LockInfo{
+			Pid:       lock.GetPid(),
+			Addr:      lock.GetAddr(),
+			IsLocked:  lock.GetLocked(),
+			Name:      lock.GetName(),
+			Namespace: lock.GetNamespace(),
+			Waiters:   make([]Waiter, 0, len(lock.GetWaiters())),
+		}
+		if lock.GetSince() != nil {
+			info.Since = lock.GetSince().AsTime()
+		}
+		for _, w := range lock.GetWaiters() {
+			info.Waiters = append(info.Waiters, Waiter{Pid: w.GetPid(), Addr: w.GetAddr(), Since: w.GetSince().AsTime()})
+		}
+		l = append(l, info)
+	}
+	return l
+}
+
+// SaveSnapshot exports the complete lock state of the server as a versioned snapshot document.
+// The force token of the server is required.
+func (c *Client) SaveSnapshot(forceToken string) ([]byte, error) {
+	resp, err := c.client.SaveSnapshot(context.Background(), &pb.SaveSnapshotRequest{ForceToken: forceToken})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.Message)
+	}
+	return resp.GetSnapshot(), nil
+}
+
+// RestoreSnapshot replaces the complete lock state of the server with a snapshot document previously
+// returned by SaveSnapshot. The force token of the server is required.
+func (c *Client) RestoreSnapshot(forceToken string, snapshot []byte) error {
+	resp, err := c.client.RestoreSnapshot(context.Background(), &pb.RestoreSnapshotRequest{ForceToken: forceToken, Snapshot: snapshot})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+	return nil
+}
+
+// History retrieves recorded lock events, oldest first. An empty lockName returns events of all locks,
+// zero times leave the time range open. In clustered mode each node records only the events of the requests it
+// handles, events of locks acquired or released through other nodes are missing.
+func (c *Client) History(lockName string, since, until time.Time) ([]HistoryEvent, error) {
+	req := &pb.HistoryRequest{LockName: lockName, Namespace: c.namespace}
+	if !since.IsZero() {
+		req.Since = timestamppb.New(since)
+	}
+	if !until.IsZero() {
+		req.Until = timestamppb.New(until)
+	}
+	resp, err := c.client.History(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]HistoryEvent, 0, len(resp.GetEvents()))
+	for _, e := range resp.GetEvents() {
+		if e == nil {
+			continue
+		}
+		events = append(events, historyEvent(e))
+	}
+	return events, nil
+}
+
+// Watch streams the events of the lock as they happen. The returned channel is closed once ctx is done or the
+// stream ended, e.g. because the connection was lost or lockd shut down. In clustered mode only the events of the
+// requests handled by the connected node are streamed, see History.
+func (c *Client) Watch(ctx context.Context, lockName string) (<-chan HistoryEvent, error) {
+	return c.watch(ctx, &pb.WatchRequest{LockName: lockName, Namespace: c.namespace})
+}
+
+// WatchPrefix streams the events of all locks whose name starts with prefix, see Watch.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string) (<-chan HistoryEvent, error) {
+	return c.watch(ctx, &pb.WatchRequest{Prefix: prefix, Namespace: c.namespace})
+}
+
+// WatchAllNamespaces streams the events of all locks of all namespaces whose name starts with prefix, see Watch.
+func (c *Client) WatchAllNamespaces(ctx context.Context, prefix string) (<-chan HistoryEvent, error) {
+	return c.watch(ctx, &pb.WatchRequest{Prefix: prefix, AllNamespaces: true})
+}
+
+// watch starts a Watch call and returns once lockd established the watch, so no event recorded afterwards is missed.
+func (c *Client) watch(ctx context.Context, req *pb.WatchRequest) (<-chan HistoryEvent, error) {
+	stream, err := c.client.Watch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	md, err := stream.Header()
+	if err == nil && md == nil {
+		// the call ended without headers, e.g. it was rejected, Recv returns the reason
+		_, err = stream.Recv()
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan HistoryEvent)
+	go func() {
+		defer close(events)
+		for {
+			e, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case events <- historyEvent(e):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// historyEvent converts a received event.
+func historyEvent(e *pb.HistoryEvent) HistoryEvent {
+	return HistoryEvent{
+		Time:      e.GetTime().AsTime(),
+		Type:      e.GetType(),
+		Name:      e.GetLockName(),
+		Namespace: e.GetNamespace(),
+		Pid:       e.GetPid(),
+		Addr:      e.GetAddr(),
+		Duration:  e.GetDuration().AsDuration(),
+	}
 }
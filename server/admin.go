@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sascha-andres/lockutil/internal/audit"
+	"github.com/sascha-andres/lockutil/internal/auth"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+	"github.com/sascha-andres/lockutil/internal/policy"
+
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+)
+
+// AdminServer implements the operator-only operations of the AdminService on top of a LockServer.
+// Every call requires a valid force token and, with an ACL, the admin right.
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+
+	// lockServer is the server whose locks, policies and drain state are administered.
+	lockServer *LockServer
+
+	// onDrain is called after the node started or stopped draining, may be nil.
+	onDrain func(draining bool)
+}
+
+// AdminServerOption represents a functional option for configuring an AdminServer.
+type AdminServerOption func(*AdminServer)
+
+// WithDrainHook calls fn after the node started or stopped draining, e.g. to update the health status.
+func WithDrainHook(fn func(draining bool)) AdminServerOption {
+	return func(s *AdminServer) {
+		s.onDrain = fn
+	}
+}
+
+// NewAdminServer initializes a new AdminServer for lockServer.
+func NewAdminServer(lockServer *LockServer, opts ...AdminServerOption) *AdminServer {
+	s := &AdminServer{lockServer: lockServer}
+	for _, opt := range opts {
+		if nil == opt {
+			continue
+		}
+		opt(s)
+	}
+	return s
+}
+
+// authorize checks the admin right and the force token of the caller, recording a denial of action in the audit log.
+func (s *AdminServer) authorize(ctx context.Context, action audit.Action, token string) error {
+	if err := s.lockServer.authorize(ctx, auth.RightAdmin, auth.AnyLock, auth.AnyLock); err != nil {
+		return err
+	}
+	if msg := s.lockServer.checkToken(token); msg != "" {
+		s.record(ctx, action, audit.OutcomeDenied, "", "", msg)
+		return status.Error(codes.PermissionDenied, msg)
+	}
+	return nil
+}
+
+// record writes an entry for action on the lock to the audit log.
+func (s *AdminServer) record(ctx context.Context, action audit.Action, outcome audit.Outcome, namespace, name, detail string) {
+	e := auditEntry(ctx, action, outcome)
+	e.Namespace, e.Lock, e.Detail = namespace, name, detail
+	s.lockServer.audit.Record(e)
+}
+
+// release releases all held locks selected by match within namespace or all namespaces, recording each release
+// as action in the audit log.
+func (s *AdminServer) release(ctx context.Context, action audit.Action, namespace string, allNamespaces bool, detail string, match func(types.LockInfo) bool) *pb.AdminReleaseResponse {
+	resp := &pb.AdminReleaseResponse{Released: make([]*pb.Lock, 0), Errors: make([]string, 0)}
+	for _, lock := range s.lockServer.manager.GetLocks(ctx) {
+		if !lock.IsLocked || (!allNamespaces && lock.Namespace != namespace) || !match(lock) {
+			continue
+		}
+		info := s.lockServer.lockInfo(lock)
+		if err := s.lockServer.manager.ReleaseLockByName(ctx, lock.Namespace, lock.Name); err != nil {
+			s.record(ctx, action, audit.OutcomeFailed, lock.Namespace, lock.Name, err.Error())
+			resp.Errors = append(resp.Errors, fmt.Sprintf("%s/%s: %v", lock.Namespace, lock.Name, err))
+			continue
+		}
+		s.record(ctx, action, audit.OutcomeSuccess, lock.Namespace, lock.Name, detail)
+		resp.Released = append(resp.Released, info)
+	}
+	return resp
+}
+
+// ForceRelease releases locks held by anyone, selected by name or name pattern
+func (s *AdminServer) ForceRelease(ctx context.Context, req *pb.ForceReleaseRequest) (*pb.AdminReleaseResponse, error) {
+	if err := s.authorize(ctx, audit.ActionForceRelease, req.GetForceToken()); err != nil {
+		return nil, err
+	}
+	if req.GetLockName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "lock name required")
+	}
+	namespace := types.Namespace(req.GetNamespace())
+	s.lockServer.logger.Info("admin force release requested", "namespace", namespace, "all_namespaces", req.GetAllNamespaces(), "lock", req.GetLockName(), "pattern", req.GetPattern(), "remote", extractRemote(ctx))
+	resp := s.release(ctx, audit.ActionForceRelease, namespace, req.GetAllNamespaces(), "", func(lock types.LockInfo) bool {
+		if req.GetPattern() {
+			return auth.Match(req.GetLockName(), lock.Name)
+		}
+		return lock.Name == req.GetLockName()
+	})
+	if !req.GetPattern() && len(resp.Released) == 0 && len(resp.Errors) == 0 {
+		s.record(ctx, audit.ActionForceRelease, audit.OutcomeFailed, namespace, req.GetLockName(), "lock not held")
+		resp.Errors = append(resp.Errors, fmt.Sprintf("%s/%s: lock not held", namespace, req.GetLockName()))
+	}
+	return resp, nil
+}
+
+// ReleaseOwner releases all locks held by an owner
+func (s *AdminServer) ReleaseOwner(ctx context.Context, req *pb.ReleaseOwnerRequest) (*pb.AdminReleaseResponse, error) {
+	if err := s.authorize(ctx, audit.ActionReleaseOwner, req.GetForceToken()); err != nil {
+		return nil, err
+	}
+	if req.GetAddr() == "" {
+		return nil, status.Error(codes.InvalidArgument, "owner address required")
+	}
+	namespace := types.Namespace(req.GetNamespace())
+	owner := req.GetAddr()
+	if req.GetPid() != 0 {
+		owner = fmt.Sprintf("%s pid %d", req.GetAddr(), req.GetPid())
+	}
+	s.lockServer.logger.Info("admin owner release requested", "namespace", namespace, "all_namespaces", req.GetAllNamespaces(), "owner", owner, "remote", extractRemote(ctx))
+	return s.release(ctx, audit.ActionReleaseOwner, namespace, req.GetAllNamespaces(), "owner "+owner, func(lock types.LockInfo) bool {
+		return lock.Addr == req.GetAddr() && (req.GetPid() == 0 || lock.Pid == req.GetPid())
+	}), nil
+}
+
+// Drain stops or resumes accepting lock requests on the serving node
+func (s *AdminServer) Drain(ctx context.Context, req *pb.DrainRequest) (*pb.DrainResponse, error) {
+	action := audit.ActionDrain
+	if req.GetResume() {
+		action = audit.ActionResume
+	}
+	if err := s.authorize(ctx, action, req.GetForceToken()); err != nil {
+		return nil, err
+	}
+	if req.GetResume() {
+		if err := s.lockServer.Resume(); err != nil {
+			s.record(ctx, action, audit.OutcomeFailed, "", "", err.Error())
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+	} else {
+		s.lockServer.Drain()
+	}
+	s.record(ctx, action, audit.OutcomeSuccess, "", "", "")
+	s.lockServer.logger.Info("drain state changed", "draining", s.lockServer.Draining(), "remote", extractRemote(ctx))
+	if s.onDrain != nil {
+		s.onDrain(s.lockServer.Draining())
+	}
+	resp := &pb.DrainResponse{Draining: s.lockServer.Draining()}
+	for _, lock := range s.lockServer.manager.GetLocks(ctx) {
+		if lock.IsLocked {
+			resp.HeldLocks++
+		}
+		resp.Waiters += int32(len(s.lockServer.manager.Waiters(lock.Namespace, lock.Name)))
+	}
+	return resp, nil
+}
+
+// SetPolicy adds, replaces or removes a lock policy on the serving node
+func (s *AdminServer) SetPolicy(ctx context.Context, req *pb.SetPolicyRequest) (*pb.SetPolicyResponse, error) {
+	if err := s.authorize(ctx, audit.ActionSetPolicy, req.GetForceToken()); err != nil {
+		return nil, err
+	}
+	p := policy.Policy{
+		Namespace:         req.GetPolicy().GetNamespace(),
+		Pattern:           req.GetPolicy().GetPattern(),
+		MaxTimeoutSeconds: req.GetPolicy().GetMaxTimeoutSeconds(),
+		Frozen:            req.GetPolicy().GetFrozen(),
+	}
+	detail := fmt.Sprintf("max timeout %ds, frozen %t", p.MaxTimeoutSeconds, p.Frozen)
+	if req.GetRemove() {
+		detail = "removed"
+		if !s.lockServer.policies.Remove(p) {
+			s.record(ctx, audit.ActionSetPolicy, audit.OutcomeFailed, p.Namespace, p.Pattern, "policy not found")
+			return nil, status.Errorf(codes.NotFound, "no policy for %q in namespace %q", p.Pattern, p.Namespace)
+		}
+	} else if err := s.lockServer.policies.Put(p); err != nil {
+		s.record(ctx, audit.ActionSetPolicy, audit.OutcomeFailed, p.Namespace, p.Pattern, err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.record(ctx, audit.ActionSetPolicy, audit.OutcomeSuccess, p.Namespace, p.Pattern, detail)
+	s.lockServer.logger.Info("lock policy changed", "namespace", p.Namespace, "pattern", p.Pattern, "detail", detail, "remote", extractRemote(ctx))
+	return &pb.SetPolicyResponse{Policies: s.policies()}, nil
+}
+
+// DumpState returns locks, waiters, policies and the drain state of the serving node
+func (s *AdminServer) DumpState(ctx context.Context, req *pb.DumpStateRequest) (*pb.DumpStateResponse, error) {
+	if err := s.authorize(ctx, audit.ActionDumpState, req.GetForceToken()); err != nil {
+		return nil, err
+	}
+	resp := &pb.DumpStateResponse{
+		Locks:    make([]*pb.Lock, 0),
+		Policies: s.policies(),
+		Draining: s.lockServer.Draining(),
+	}
+	for _, lock := range s.lockServer.manager.GetLocks(ctx) {
+		resp.Locks = append(resp.Locks, s.lockServer.lockInfo(lock))
+	}
+	s.record(ctx, audit.ActionDumpState, audit.OutcomeSuccess, "", "", "")
+	return resp, nil
+}
+
+// policies returns the policies of the node in the order they are matched.
+func (s *AdminServer) policies() []*pb.LockPolicy {
+	result := make([]*pb.LockPolicy, 0)
+	for _, p := range s.lockServer.policies.List() {
+		result = append(result, &pb.LockPolicy{
+			Namespace:         p.Namespace,
+			Pattern:           p.Pattern,
+			MaxTimeoutSeconds: p.MaxTimeoutSeconds,
+			Frozen:            p.Frozen,
+		})
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/sascha-andres/lockutil/internal/audit"
+	"github.com/sascha-andres/lockutil/internal/auth"
+)
+
+// Authenticator validates bearer tokens sent as gRPC metadata and attaches the principal to the request context.
+type Authenticator struct {
+	tokens *auth.Tokens
+
+	// audit records rejected tokens, nil to disable auditing.
+	audit *audit.Log
+}
+
+// NewAuthenticator creates an Authenticator accepting the tokens of the given token file.
+func NewAuthenticator(tokenFile string) (*Authenticator, error) {
+	tokens, err := auth.LoadTokens(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{tokens: tokens}, nil
+}
+
+// Reload replaces the accepted tokens with the tokens of the given token file. On error the active tokens are kept.
+func (a *Authenticator) Reload(tokenFile string) error {
+	tokens, err := auth.LoadTokens(tokenFile)
+	if err != nil {
+		return err
+	}
+	a.tokens.Update(tokens)
+	return nil
+}
+
+// SetAudit records rejected bearer tokens in l.
+func (a *Authenticator) SetAudit(l *audit.Log) {
+	a.audit = l
+}
+
+// authenticate returns a context carrying the principal of the bearer token of the request.
+func (a *Authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, a.reject(ctx, "missing bearer token")
+	}
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return nil, a.reject(ctx, "authorization is not a bearer token")
+	}
+	principal, ok := a.tokens.Principal(token)
+	if !ok {
+		slog.Warn("invalid token rejected", "remote", extractRemote(ctx))
+		return nil, a.reject(ctx, "invalid token")
+	}
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+// reject records the failed authentication in the audit log and returns an Unauthenticated error with msg.
+func (a *Authenticator) reject(ctx context.Context, msg string) error {
+	e := auditEntry(ctx, audit.ActionAuthenticate, audit.OutcomeDenied)
+	e.Detail = msg
+	a.audit.Record(e)
+	return status.Error(codes.Unauthenticated, msg)
+}
+
+// healthService is the method prefix of the grpc.health.v1 service, health checks do not require a token.
+const healthService = "/grpc.health.v1.Health/"
+
+// UnaryInterceptor rejects unary calls without a valid bearer token.
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if strings.HasPrefix(info.FullMethod, healthService) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor rejects streaming calls without a valid bearer token.
+func (a *Authenticator) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if strings.HasPrefix(info.FullMethod, healthService) {
+		return handler(srv, ss)
+	}
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream is a grpc.ServerStream whose context carries the authenticated principal.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying the authenticated principal.
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sascha-andres/lockutil/internal/audit"
+	"github.com/sascha-andres/lockutil/internal/auth"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/cluster"
+
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+)
+
+// ClusterServer receives commands forwarded by follower nodes and applies them on the raft leader.
+type ClusterServer struct {
+	pb.UnimplementedClusterServiceServer
+	node   *cluster.Node
+	secret string
+	acl    *auth.ACL
+	audit  *audit.Log
+
+	// logger receives log records of the server.
+	logger *slog.Logger
+}
+
+// ClusterServerOption defines a function type that modifies some aspect of a ClusterServer during its creation.
+type ClusterServerOption func(*ClusterServer)
+
+// WithClusterLogger sets the logger of the ClusterServer, defaults to slog.Default().
+func WithClusterLogger(logger *slog.Logger) ClusterServerOption {
+	return func(s *ClusterServer) {
+		s.logger = logger
+	}
+}
+
+// NewClusterServer initializes a new ClusterServer for the given cluster node. Only calls carrying the cluster
+// secret are accepted, an empty secret is rejected with cluster.ErrNoSecret. When acl is not nil, callers need
+// the cluster right as well.
+func NewClusterServer(node *cluster.Node, secret string, acl *auth.ACL, opts ...ClusterServerOption) (*ClusterServer, error) {
+	if secret == "" {
+		return nil, cluster.ErrNoSecret
+	}
+	s := &ClusterServer{node: node, secret: secret, acl: acl, logger: slog.Default()}
+	for _, opt := range opts {
+		if nil == opt {
+			continue
+		}
+		opt(s)
+	}
+	return s, nil
+}
+
+// SetAudit records denied cluster commands in l.
+func (s *ClusterServer) SetAudit(l *audit.Log) {
+	s.audit = l
+}
+
+// Apply applies a forwarded command to the replicated lock state
+func (s *ClusterServer) Apply(ctx context.Context, req *pb.ApplyRequest) (*pb.ApplyResponse, error) {
+	if !cluster.VerifySecret(ctx, s.secret) {
+		s.logger.Warn("cluster apply without valid cluster secret", "principal", auth.PrincipalFromContext(ctx), "remote", extractRemote(ctx))
+		s.audit.Record(auditEntry(ctx, audit.ActionAuthenticate, audit.OutcomeDenied))
+		return nil, status.Error(codes.PermissionDenied, "cluster secret required")
+	}
+	if s.acl != nil && !s.acl.Allowed(auth.PrincipalFromContext(ctx), auth.RightCluster, auth.AnyLock, auth.AnyLock) {
+		s.logger.Warn("cluster apply denied", "principal", auth.PrincipalFromContext(ctx), "remote", extractRemote(ctx))
+		e := auditEntry(ctx, audit.ActionAuthorize, audit.OutcomeDenied)
+		e.Right = string(auth.RightCluster)
+		s.audit.Record(e)
+		return nil, status.Error(codes.PermissionDenied, "cluster not permitted")
+	}
+	if err := s.node.Apply(req.GetCommand()); err != nil {
+		return &pb.ApplyResponse{Error: err.Error()}, nil
+	}
+	return &pb.ApplyResponse{}, nil
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+	"github.com/sascha-andres/lockutil/internal/tracing"
+)
+
+// NewGateway returns an HTTP handler serving acquire, release, list and history of lockService as JSON below /v1/,
+// lock events as server-sent events at /v1/watch and the OpenAPI document at /openapi.json. Calls are passed through interceptors in the given order, like
+// grpc.ChainUnaryInterceptor does for gRPC calls, so bearer tokens sent in the Authorization header are checked
+// the same way. The HTTP client address or verified certificate subject identifies the lock owner.
+func NewGateway(ctx context.Context, lockService pb.LockServiceServer, interceptors ...grpc.UnaryServerInterceptor) (http.Handler, error) {
+	marshaler := &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	gateway := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler))
+	service := &gatewayService{lockService: lockService, interceptors: interceptors}
+	if err := pb.RegisterLockServiceHandlerServer(ctx, gateway, service); err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", withPeer(gateway))
+	mux.Handle("GET /v1/watch", withPeer(service.watchHandler(gateway, marshaler)))
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(pb.OpenAPI)
+	})
+	return mux, nil
+}
+
+// withPeer attaches the HTTP client as gRPC peer to the request context, so the lock server identifies it like
+// a gRPC client. A trace context sent in the traceparent header becomes the parent of the lock spans.
+func withPeer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &peer.Peer{Addr: httpAddr(r.RemoteAddr)}
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{State: *r.TLS, CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity}}
+		}
+		ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(peer.NewContext(ctx, p)))
+	})
+}
+
+// httpAddr is the host:port address of an HTTP client.
+type httpAddr string
+
+// Network returns the network of the address.
+func (a httpAddr) Network() string {
+	return "tcp"
+}
+
+// String returns the address as host:port.
+func (a httpAddr) String() string {
+	return string(a)
+}
+
+// gatewayService calls the lock service through the interceptors.
+type gatewayService struct {
+	pb.UnimplementedLockServiceServer
+
+	// lockService handles the calls.
+	lockService pb.LockServiceServer
+
+	// interceptors are run in order before each call.
+	interceptors []grpc.UnaryServerInterceptor
+}
+
+// RequestLock acquires a lock.
+func (g *gatewayService) RequestLock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
+	return intercept(ctx, g, "/lockutility.LockService/RequestLock", req, g.lockService.RequestLock)
+}
+
+// ReleaseLock releases a lock.
+func (g *gatewayService) ReleaseLock(ctx context.Context, req *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
+	return intercept(ctx, g, "/lockutility.LockService/ReleaseLock", req, g.lockService.ReleaseLock)
+}
+
+// List lists locks.
+func (g *gatewayService) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	return intercept(ctx, g, "/lockutility.LockService/List", req, g.lockService.List)
+}
+
+// History lists recorded lock events.
+func (g *gatewayService) History(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	return intercept(ctx, g, "/lockutility.LockService/History", req, g.lockService.History)
+}
+
+// Stats returns contention statistics.
+func (g *gatewayService) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	return intercept(ctx, g, "/lockutility.LockService/Stats", req, g.lockService.Stats)
+}
+
+// intercept runs the interceptors of g and finally call.
+func intercept[Req, Resp any](ctx context.Context, g *gatewayService, method string, req Req, call func(context.Context, Req) (Resp, error)) (Resp, error) {
+	info := &grpc.UnaryServerInfo{Server: g.lockService, FullMethod: method}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return call(ctx, req.(Req))
+	}
+	for i := len(g.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := g.interceptors[i], handler
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	resp, err := handler(ctx, req)
+	result, _ := resp.(Resp)
+	return result, err
+}
+
+// watchMethod is the full gRPC method name of Watch, used for interceptors and metrics.
+const watchMethod = "/lockutility.LockService/Watch"
+
+// watchHandler streams lock events as server-sent events, the data of each event is a HistoryEvent as JSON. The
+// query parameters are the fields of WatchRequest. Errors before the stream started are answered like other
+// gateway calls, later ones end the stream with an error event carrying the status as JSON.
+func (g *gatewayService) watchHandler(gateway *runtime.ServeMux, marshaler runtime.Marshaler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &pb.WatchRequest{}
+		if err := runtime.PopulateQueryParameters(req, r.URL.Query(), utilities.NewDoubleArray(nil)); err != nil {
+			runtime.HTTPError(r.Context(), gateway, marshaler, w, r, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+		ctx, err := runtime.AnnotateIncomingContext(r.Context(), gateway, r, watchMethod, runtime.WithHTTPPathPattern("/v1/watch"))
+		if err != nil {
+			runtime.HTTPError(r.Context(), gateway, marshaler, w, r, err)
+			return
+		}
+		stream := &eventStream{ctx: ctx, w: w, marshaler: marshaler}
+		_, err = intercept(ctx, g, watchMethod, req, func(ctx context.Context, req *pb.WatchRequest) (any, error) {
+			stream.ctx = ctx
+			return nil, g.lockService.Watch(req, stream)
+		})
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if !stream.started {
+			runtime.HTTPError(ctx, gateway, marshaler, w, r, err)
+			return
+		}
+		if data, marshalErr := marshaler.Marshal(status.Convert(err).Proto()); marshalErr == nil {
+			_ = stream.write("error", data)
+		}
+	}
+}
+
+// eventStream is a pb.LockService_WatchServer writing the events as server-sent events.
+type eventStream struct {
+	ctx       context.Context
+	w         http.ResponseWriter
+	marshaler runtime.Marshaler
+
+	// started is set once the HTTP response headers were sent.
+	started bool
+}
+
+// Send writes an event.
+func (s *eventStream) Send(e *pb.HistoryEvent) error {
+	data, err := s.marshaler.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.write("", data)
+}
+
+// write writes a server-sent event of the given type, the default type if empty, and flushes it to the client.
+func (s *eventStream) write(eventType string, data []byte) error {
+	if err := s.SendHeader(nil); err != nil {
+		return err
+	}
+	if eventType != "" {
+		if _, err := fmt.Fprintf(s.w, "event: %s\n", eventType); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return http.NewResponseController(s.w).Flush()
+}
+
+// SendHeader starts the HTTP response, signalling the client that the watch is established.
+func (s *eventStream) SendHeader(metadata.MD) error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	return http.NewResponseController(s.w).Flush()
+}
+
+// SetHeader is not supported, headers are ignored.
+func (s *eventStream) SetHeader(metadata.MD) error {
+	return nil
+}
+
+// SetTrailer is not supported, trailers are ignored.
+func (s *eventStream) SetTrailer(metadata.MD) {}
+
+// Context returns the context of the HTTP request.
+func (s *eventStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg writes an event.
+func (s *eventStream) SendMsg(m any) error {
+	e, ok := m.(*pb.HistoryEvent)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message %T", m)
+	}
+	return s.Send(e)
+}
+
+// RecvMsg is not supported, Watch does not receive messages after the request.
+func (s *eventStream) RecvMsg(any) error {
+	return status.Error(codes.Unimplemented, "receiving is not supported")
+}
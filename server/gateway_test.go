@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+)
+
+// recordingLockService remembers the lock names of the calls it receives.
+type recordingLockService struct {
+	pb.UnimplementedLockServiceServer
+	names []string
+}
+
+// RequestLock records the lock name and reports the lock as acquired.
+func (s *recordingLockService) RequestLock(_ context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
+	s.names = append(s.names, req.GetLockName())
+	return &pb.LockResponse{Success: true}, nil
+}
+
+// ReleaseLock records the lock name and reports the lock as released.
+func (s *recordingLockService) ReleaseLock(_ context.Context, req *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
+	s.names = append(s.names, req.GetLockName())
+	return &pb.ReleaseResponse{Success: true}, nil
+}
+
+func TestGatewayLockNames(t *testing.T) {
+	for _, tc := range []struct{ path, name string }{
+		{"/v1/locks/db/acquire", "db"},
+		{"/v1/locks/db/release", "db"},
+		{"/v1/locks/team-a%2Fdeploy/acquire", "team-a/deploy"},
+		{"/v1/locks/team-a%2Fdeploy/release", "team-a/deploy"},
+		{"/v1/locks/team-a/deploy/acquire", "team-a/deploy"},
+		{"/v1/locks/team-a/jobs/nightly/release", "team-a/jobs/nightly"},
+		{"/v1/locks/acquire/acquire", "acquire"},
+		// escaped as a whole like the dashboard does
+		{"/v1/locks/team-a%2F..%2Fdeploy/release", "team-a/../deploy"},
+		{"/v1/locks/team-a%2F%2Fdeploy/release", "team-a//deploy"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			service := &recordingLockService{}
+			gateway, err := NewGateway(context.Background(), service)
+			if err != nil {
+				t.Fatalf("creating gateway: %v", err)
+			}
+			srv := httptest.NewServer(gateway)
+			defer srv.Close()
+
+			resp, err := http.Post(srv.URL+tc.path, "application/json", strings.NewReader(`{"pid": 1}`))
+			if err != nil {
+				t.Fatalf("posting: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", resp.StatusCode)
+			}
+			if len(service.names) != 1 || service.names[0] != tc.name {
+				t.Errorf("expected a call for %q, got %v", tc.name, service.names)
+			}
+		})
+	}
+}
@@ -1,47 +1,310 @@
 package server
 
 import (
+	"bytes"
 	"context"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/sascha-andres/lockutil/internal/audit"
+	"github.com/sascha-andres/lockutil/internal/auth"
 	"github.com/sascha-andres/lockutil/internal/lockmanager"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/history"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/snapshot"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/stats"
+	"github.com/sascha-andres/lockutil/internal/lockmanager/types"
+	"github.com/sascha-andres/lockutil/internal/metrics"
+	"github.com/sascha-andres/lockutil/internal/peercred"
+	"github.com/sascha-andres/lockutil/internal/policy"
+	"github.com/sascha-andres/lockutil/internal/quota"
 
 	pb "github.com/sascha-andres/lockutil/internal/lockserver" // Import the generated proto package
 )
 
 type LockServer struct {
 	pb.UnimplementedLockServiceServer
-	manager     *lockmanager.LockManager
-	verbose     bool
-	secretToken string
+	manager *lockmanager.LockManager
+
+	// logger receives log records of the server and its LockManager.
+	logger *slog.Logger
+
+	// forceTokens are the tokens accepted for forced releases and snapshots.
+	forceTokens *auth.ForceTokens
+
+	// managerOptions are passed to the LockManager when the server is created.
+	managerOptions []lockmanager.LockManagerOption
+
+	// acl restricts which principal may do what on which lock, nil to allow everything.
+	acl *auth.ACL
+
+	// quota limits held locks and waiting requests per client and namespace, nil for no limits.
+	quota *quota.Tracker
+
+	// metrics counts rejected lock requests, nil to disable metrics.
+	metrics *metrics.Metrics
+
+	// audit records force releases, snapshots and ACL denials, nil to disable auditing.
+	audit *audit.Log
+
+	// policies restrict lock requests for matching locks.
+	policies *policy.Set
+
+	// draining is set by Drain and once Shutdown was called, new lock requests are rejected while it is set.
+	draining atomic.Bool
+
+	// shutdown is closed by Shutdown to abort waiting lock requests.
+	shutdown chan struct{}
+
+	// shutdownOnce guards closing shutdown.
+	shutdownOnce sync.Once
+}
+
+// LockServerOption defines a function type that modifies some aspect of a LockServer during its creation.
+type LockServerOption func(*LockServer)
+
+// WithHistorySize sets the number of lock events kept in the in-memory history.
+func WithHistorySize(size int) LockServerOption {
+	return func(s *LockServer) {
+		s.managerOptions = append(s.managerOptions, lockmanager.WithHistory(history.NewRing(size)))
+	}
+}
+
+// WithACL enforces the given access control list for every call, requires authentication to be enabled.
+func WithACL(acl *auth.ACL) LockServerOption {
+	return func(s *LockServer) {
+		s.acl = acl
+	}
+}
+
+// WithQuota enforces limits on held locks and waiting requests per client principal and namespace.
+// The limits can be changed later using SetQuota.
+func WithQuota(limits quota.Limits) LockServerOption {
+	return func(s *LockServer) {
+		s.quota = quota.NewTracker(limits)
+	}
+}
+
+// WithForceTokens sets the tokens accepted for forced releases and snapshots, replacing the token passed to
+// NewLockServer. Reloading forceTokens takes effect immediately.
+func WithForceTokens(forceTokens *auth.ForceTokens) LockServerOption {
+	return func(s *LockServer) {
+		s.forceTokens = forceTokens
+	}
+}
+
+// WithPolicies sets the policies restricting lock requests, replacing the empty set the server starts with.
+// Changes to policies take effect immediately.
+func WithPolicies(policies *policy.Set) LockServerOption {
+	return func(s *LockServer) {
+		s.policies = policies
+	}
+}
+
+// WithMetrics exports lock events, waiters and rejected requests to m.
+func WithMetrics(m *metrics.Metrics) LockServerOption {
+	return func(s *LockServer) {
+		s.metrics = m
+		s.managerOptions = append(s.managerOptions, lockmanager.WithMetrics(m))
+	}
+}
+
+// WithAudit records force releases, snapshot operations and ACL denials in l.
+func WithAudit(l *audit.Log) LockServerOption {
+	return func(s *LockServer) {
+		s.audit = l
+	}
+}
+
+// WithLogger sets the logger of the LockServer and its LockManager, defaults to slog.Default().
+func WithLogger(logger *slog.Logger) LockServerOption {
+	return func(s *LockServer) {
+		s.logger = logger
+	}
 }
 
-// NewLockServer initializes a new LockServer
-func NewLockServer(token string, verbose bool) *LockServer {
-	return &LockServer{
-		verbose:     verbose,
-		manager:     lockmanager.NewLockManager(verbose),
-		secretToken: token,
+// WithTracerProvider sets the provider of the tracer creating spans for acquire waits, releases and backend
+// operations, defaults to the global provider. The spans are children of the trace context of the request.
+func WithTracerProvider(tp trace.TracerProvider) LockServerOption {
+	return func(s *LockServer) {
+		s.managerOptions = append(s.managerOptions, lockmanager.WithTracerProvider(tp))
 	}
 }
 
+// WithLocker sets the locker backing the LockServer, defaults to an in-memory locker.
+func WithLocker(locker types.Locker) LockServerOption {
+	return func(s *LockServer) {
+		s.managerOptions = append(s.managerOptions, lockmanager.WithLocker(locker))
+	}
+}
+
+// NewLockServer initializes a new LockServer, token is the plain or hashed force token, empty to disable forced releases
+func NewLockServer(token string, opts ...LockServerOption) *LockServer {
+	s := &LockServer{
+		logger:   slog.Default(),
+		policies: policy.NewSet(),
+		shutdown: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if nil == opt {
+			continue
+		}
+		opt(s)
+	}
+	if s.forceTokens == nil {
+		forceTokens, err := auth.NewForceTokens(token)
+		if err != nil {
+			s.logger.Warn("forceful release deactivated", "error", err)
+		}
+		s.forceTokens = forceTokens
+	}
+	s.manager = lockmanager.NewLockManager(append(s.managerOptions, lockmanager.WithLogger(s.logger))...)
+	return s
+}
+
 // RequestLock handles lock requests from clients
 func (s *LockServer) RequestLock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
-	addr := extractRemote(ctx)
-	if s.verbose {
-		log.Printf("RequestLock request for %s from %d with timeout %d", req.GetLockName(), req.GetPid(), req.GetTimeoutSeconds())
+	addr := identity(ctx)
+	pid := ownerPID(ctx, req.GetPid())
+	namespace := types.Namespace(req.GetNamespace())
+	if s.draining.Load() {
+		s.metrics.Rejected(namespace, s.drainReason())
+		return nil, status.Error(codes.Unavailable, types.ErrShuttingDown.Error())
+	}
+	if err := s.authorize(ctx, auth.RightAcquire, namespace, req.GetLockName()); err != nil {
+		s.metrics.Rejected(namespace, "permission")
+		return nil, err
+	}
+	timeoutSeconds := req.GetTimeoutSeconds()
+	if p, ok := s.policies.Match(namespace, req.GetLockName()); ok {
+		if p.Frozen {
+			s.metrics.Rejected(namespace, "policy")
+			return nil, status.Errorf(codes.FailedPrecondition, "lock %q in namespace %q is frozen by policy %q", req.GetLockName(), namespace, p.Pattern)
+		}
+		if p.MaxTimeoutSeconds > 0 && timeoutSeconds > p.MaxTimeoutSeconds {
+			timeoutSeconds = p.MaxTimeoutSeconds
+		}
+	}
+	client := auth.PrincipalFromContext(ctx)
+	if client == "" {
+		client = addr
+	}
+	var request *quota.Request
+	if s.quota != nil {
+		var err error
+		request, err = s.quota.Begin(client, namespace, func() []types.LockInfo { return s.manager.GetLocks(ctx) })
+		if err != nil {
+			s.logger.Info("lock request rejected", "namespace", namespace, "lock", req.GetLockName(), "pid", pid, "addr", addr, "client", client, "error", err)
+			s.metrics.Rejected(namespace, "quota")
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		defer request.Done()
+	}
+	s.logger.Debug("lock requested", "namespace", namespace, "lock", req.GetLockName(), "pid", pid, "addr", addr, "timeout", time.Duration(timeoutSeconds)*time.Second)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := s.manager.RequestLock(ctx, namespace, req.LockName, pid, addr, timeoutSeconds)
+	if errors.Is(err, types.ErrLockTimeout) {
+		// an elapsed timeout has always been answered with success, the lock is not held and does not count
+		// towards the quota though
+		return &pb.LockResponse{Success: true, Message: "Timeout waiting for lock"}, nil
+	}
+	if err != nil && s.draining.Load() {
+		s.logger.Info("lock request aborted", "namespace", namespace, "lock", req.GetLockName(), "pid", pid, "addr", addr, "error", types.ErrShuttingDown)
+		return nil, status.Error(codes.Unavailable, types.ErrShuttingDown.Error())
 	}
-	err := s.manager.RequestLock(req.LockName, req.Pid, addr, req.TimeoutSeconds)
 	if err != nil {
-		log.Printf("RequestLock failed for %s from %d: %s", req.GetLockName(), req.GetPid(), err.Error())
+		s.logger.Info("lock request failed", "namespace", namespace, "lock", req.GetLockName(), "pid", pid, "addr", addr, "error", err)
 		return &pb.LockResponse{Success: false, Message: err.Error()}, nil
 	}
+	if request != nil {
+		request.Acquired(req.GetLockName(), addr)
+	}
 	return &pb.LockResponse{Success: true, Message: "Lock acquired"}, nil
 }
 
+// SetQuota replaces the quota limits, it has no effect unless the server was created using WithQuota.
+func (s *LockServer) SetQuota(limits quota.Limits) {
+	if s.quota != nil {
+		s.quota.SetLimits(limits)
+	}
+}
+
+// Drain rejects new lock requests with an Unavailable status carrying types.ErrShuttingDown, so clients move to
+// another node. Held locks and waiting requests are kept, releases are still served.
+func (s *LockServer) Drain() {
+	s.draining.Store(true)
+}
+
+// Resume accepts lock requests again after Drain. Returns types.ErrShuttingDown once Shutdown was called.
+func (s *LockServer) Resume() error {
+	select {
+	case <-s.shutdown:
+		return types.ErrShuttingDown
+	default:
+	}
+	s.draining.Store(false)
+	return nil
+}
+
+// Draining reports whether new lock requests are rejected.
+func (s *LockServer) Draining() bool {
+	return s.draining.Load()
+}
+
+// drainReason returns the metrics reason for requests rejected while draining.
+func (s *LockServer) drainReason() string {
+	select {
+	case <-s.shutdown:
+		return "shutdown"
+	default:
+		return "drain"
+	}
+}
+
+// Shutdown starts draining the server: new lock requests are rejected and waiting ones are aborted, both with
+// an Unavailable status carrying types.ErrShuttingDown. Releases are still served until the gRPC server stops.
+func (s *LockServer) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		s.draining.Store(true)
+		close(s.shutdown)
+	})
+}
+
+// WriteState writes the complete lock state as snapshot document to w.
+func (s *LockServer) WriteState(ctx context.Context, w io.Writer) error {
+	return s.manager.Snapshot(ctx).Write(w)
+}
+
+// ReadState replaces the complete lock state with the snapshot document read from r.
+func (s *LockServer) ReadState(ctx context.Context, r io.Reader) error {
+	snap, err := snapshot.Read(r)
+	if err != nil {
+		return err
+	}
+	return s.manager.Restore(ctx, snap)
+}
+
 // extractRemote extracts the remote address from a context containing peer information and returns it as a string.
 func extractRemote(ctx context.Context) string {
 	p, _ := peer.FromContext(ctx)
@@ -53,23 +316,106 @@ func extractRemote(ctx context.Context) string {
 	return addr
 }
 
+// auditEntry returns an audit entry for action with the principal and remote address of the caller.
+func auditEntry(ctx context.Context, action audit.Action, outcome audit.Outcome) audit.Entry {
+	return audit.Entry{
+		Action:    action,
+		Outcome:   outcome,
+		Principal: auth.PrincipalFromContext(ctx),
+		Remote:    extractRemote(ctx),
+	}
+}
+
+// identity returns the owner identity of the caller. When the client presented a verified certificate
+// its subject is used, for Unix socket connections the user ID of the peer process, otherwise the remote address.
+func identity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		if credInfo, isUnix := p.AuthInfo.(peercred.Info); isUnix {
+			return credInfo.Identity()
+		}
+		if tlsInfo, isTLS := p.AuthInfo.(credentials.TLSInfo); isTLS && len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+			return tlsInfo.State.VerifiedChains[0][0].Subject.String()
+		}
+	}
+	return extractRemote(ctx)
+}
+
+// ownerPID returns the pid to record as lock owner. For Unix socket connections the pid sent by the client is
+// only trusted if it is the peer process or its parent, otherwise the pid of the peer process is used.
+func ownerPID(ctx context.Context, pid int32) int32 {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return pid
+	}
+	credInfo, isUnix := p.AuthInfo.(peercred.Info)
+	if !isUnix || credInfo.Owns(pid) {
+		return pid
+	}
+	return credInfo.PID
+}
+
+// authorize returns a PermissionDenied error if the ACL does not grant right on the lock to the caller.
+func (s *LockServer) authorize(ctx context.Context, right auth.Right, namespace, name string) error {
+	if s.acl == nil {
+		return nil
+	}
+	principal := auth.PrincipalFromContext(ctx)
+	if s.acl.Allowed(principal, right, namespace, name) {
+		return nil
+	}
+	s.logger.Warn("permission denied", "right", right, "namespace", namespace, "lock", name, "principal", principal, "remote", extractRemote(ctx))
+	e := auditEntry(ctx, audit.ActionAuthorize, audit.OutcomeDenied)
+	e.Right, e.Namespace, e.Lock = string(right), namespace, name
+	s.audit.Record(e)
+	return status.Errorf(codes.PermissionDenied, "%s on %q in namespace %q not permitted", right, name, namespace)
+}
+
+// visible reports whether the caller may see the lock in listings.
+func (s *LockServer) visible(ctx context.Context, namespace, name string) bool {
+	return s.acl == nil || s.acl.Allowed(auth.PrincipalFromContext(ctx), auth.RightList, namespace, name)
+}
+
+// checkToken verifies a force token, returning a message describing the failure or an empty string if the token is valid.
+func (s *LockServer) checkToken(token string) string {
+	if !s.forceTokens.Enabled() {
+		return "Forceful release deactivated"
+	}
+	if !s.forceTokens.Verify(token) {
+		return "Invalid secret token"
+	}
+	return ""
+}
+
 // ReleaseLock handles lock release requests from clients
 func (s *LockServer) ReleaseLock(ctx context.Context, req *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
-	addr := extractRemote(ctx)
-	if req.GetForceToken() != "" && s.secretToken == "" {
-		return &pb.ReleaseResponse{Success: false, Message: "Forceful release deactivated"}, nil
+	addr := identity(ctx)
+	pid := ownerPID(ctx, req.GetPid())
+	namespace := types.Namespace(req.GetNamespace())
+	right := auth.RightRelease
+	if req.GetForceToken() != "" {
+		right = auth.RightForceRelease
 	}
-	if req.GetForceToken() != "" && req.GetForceToken() != s.secretToken {
-		return &pb.ReleaseResponse{Success: false, Message: "Invalid secret token"}, nil
+	if err := s.authorize(ctx, right, namespace, req.GetLockName()); err != nil {
+		return nil, err
 	}
-	if s.verbose {
-		log.Printf("ReleaseLock request for %s from %d, is forced: %t", req.GetLockName(), req.GetPid(), req.GetForceToken() != "")
+	if req.GetForceToken() != "" {
+		if msg := s.checkToken(req.GetForceToken()); msg != "" {
+			s.auditForceRelease(ctx, namespace, req.GetLockName(), audit.OutcomeDenied, msg)
+			return &pb.ReleaseResponse{Success: false, Message: msg}, nil
+		}
 	}
+	s.logger.Debug("lock release requested", "namespace", namespace, "lock", req.GetLockName(), "pid", pid, "addr", addr, "forced", req.GetForceToken() != "")
 	var err error
 	if req.GetForceToken() == "" {
-		err = s.manager.ReleaseLock(req.LockName, req.Pid, addr)
+		err = s.manager.ReleaseLock(ctx, namespace, req.LockName, pid, addr)
 	} else {
-		err = s.manager.ReleaseLockByName(req.LockName)
+		err = s.manager.ReleaseLockByName(ctx, namespace, req.LockName)
+		if err != nil {
+			s.auditForceRelease(ctx, namespace, req.GetLockName(), audit.OutcomeFailed, err.Error())
+		} else {
+			s.auditForceRelease(ctx, namespace, req.GetLockName(), audit.OutcomeSuccess, "")
+		}
 	}
 	if err != nil {
 		return &pb.ReleaseResponse{Success: false, Message: err.Error()}, nil
@@ -77,20 +423,212 @@ func (s *LockServer) ReleaseLock(ctx context.Context, req *pb.ReleaseRequest) (*
 	return &pb.ReleaseResponse{Success: true, Message: "Lock released"}, nil
 }
 
-// List all locks
-func (s *LockServer) List(ctx context.Context, _ *pb.ListRequest) (*pb.ListResponse, error) {
+// auditForceRelease records a forced release of the lock in the audit log.
+func (s *LockServer) auditForceRelease(ctx context.Context, namespace, name string, outcome audit.Outcome, detail string) {
+	e := auditEntry(ctx, audit.ActionForceRelease, outcome)
+	e.Namespace, e.Lock, e.Detail = namespace, name, detail
+	s.audit.Record(e)
+}
+
+// auditSnapshot records a snapshot operation in the audit log.
+func (s *LockServer) auditSnapshot(ctx context.Context, action audit.Action, outcome audit.Outcome, detail string) {
+	e := auditEntry(ctx, action, outcome)
+	e.Detail = detail
+	s.audit.Record(e)
+}
+
+// List all locks of a namespace or of all namespaces
+func (s *LockServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	namespace := types.Namespace(req.GetNamespace())
 	addr := extractRemote(ctx)
-	if s.verbose {
-		log.Printf("Listrequest from %s", addr)
-	}
+	s.logger.Debug("locks listed", "namespace", namespace, "all_namespaces", req.GetAllNamespaces(), "remote", addr)
 	resp := &pb.ListResponse{Locks: make([]*pb.Lock, 0)}
-	for _, lock := range s.manager.GetLocks() {
-		resp.Locks = append(resp.Locks, &pb.Lock{
-			Name:   lock.Name,
-			Addr:   lock.Addr,
-			Pid:    lock.Pid,
-			Locked: lock.IsLocked,
-		})
+	for _, lock := range s.manager.GetLocks(ctx) {
+		if !req.GetAllNamespaces() && lock.Namespace != namespace {
+			continue
+		}
+		if !s.visible(ctx, lock.Namespace, lock.Name) {
+			continue
+		}
+		resp.Locks = append(resp.Locks, s.lockInfo(lock))
 	}
 	return resp, nil
 }
+
+// lockInfo returns the lock including when it was acquired and the requests waiting for it on this node.
+func (s *LockServer) lockInfo(lock types.LockInfo) *pb.Lock {
+	info := &pb.Lock{
+		Name:      lock.Name,
+		Addr:      lock.Addr,
+		Pid:       lock.Pid,
+		Locked:    lock.IsLocked,
+		Namespace: lock.Namespace,
+		Waiters:   make([]*pb.Waiter, 0),
+	}
+	if since := s.manager.HeldSince(lock.Namespace, lock.Name); lock.IsLocked && !since.IsZero() {
+		info.Since = timestamppb.New(since)
+	}
+	for _, w := range s.manager.Waiters(lock.Namespace, lock.Name) {
+		info.Waiters = append(info.Waiters, &pb.Waiter{Pid: w.Pid, Addr: w.Addr, Since: timestamppb.New(w.Since)})
+	}
+	return info
+}
+
+// SaveSnapshot exports the complete lock state as a versioned snapshot document
+func (s *LockServer) SaveSnapshot(ctx context.Context, req *pb.SaveSnapshotRequest) (*pb.SaveSnapshotResponse, error) {
+	addr := extractRemote(ctx)
+	if err := s.authorize(ctx, auth.RightAdmin, auth.AnyLock, auth.AnyLock); err != nil {
+		return nil, err
+	}
+	if msg := s.checkToken(req.GetForceToken()); msg != "" {
+		s.auditSnapshot(ctx, audit.ActionSnapshotSave, audit.OutcomeDenied, msg)
+		return &pb.SaveSnapshotResponse{Success: false, Message: msg}, nil
+	}
+	s.logger.Debug("snapshot requested", "remote", addr)
+	var buf bytes.Buffer
+	if err := s.WriteState(ctx, &buf); err != nil {
+		s.auditSnapshot(ctx, audit.ActionSnapshotSave, audit.OutcomeFailed, err.Error())
+		return &pb.SaveSnapshotResponse{Success: false, Message: err.Error()}, nil
+	}
+	s.auditSnapshot(ctx, audit.ActionSnapshotSave, audit.OutcomeSuccess, "")
+	return &pb.SaveSnapshotResponse{Success: true, Message: "Snapshot taken", Snapshot: buf.Bytes()}, nil
+}
+
+// RestoreSnapshot replaces the complete lock state with the state of a snapshot document
+func (s *LockServer) RestoreSnapshot(ctx context.Context, req *pb.RestoreSnapshotRequest) (*pb.RestoreSnapshotResponse, error) {
+	addr := extractRemote(ctx)
+	if err := s.authorize(ctx, auth.RightAdmin, auth.AnyLock, auth.AnyLock); err != nil {
+		return nil, err
+	}
+	if msg := s.checkToken(req.GetForceToken()); msg != "" {
+		s.auditSnapshot(ctx, audit.ActionSnapshotRestore, audit.OutcomeDenied, msg)
+		return &pb.RestoreSnapshotResponse{Success: false, Message: msg}, nil
+	}
+	s.logger.Debug("snapshot restore requested", "remote", addr)
+	if err := s.ReadState(ctx, bytes.NewReader(req.GetSnapshot())); err != nil {
+		s.logger.Warn("snapshot restore failed", "remote", addr, "error", err)
+		s.auditSnapshot(ctx, audit.ActionSnapshotRestore, audit.OutcomeFailed, err.Error())
+		return &pb.RestoreSnapshotResponse{Success: false, Message: err.Error()}, nil
+	}
+	s.auditSnapshot(ctx, audit.ActionSnapshotRestore, audit.OutcomeSuccess, "")
+	return &pb.RestoreSnapshotResponse{Success: true, Message: "Snapshot restored"}, nil
+}
+
+// History returns recorded lock events filtered by lock name and time range
+func (s *LockServer) History(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	addr := extractRemote(ctx)
+	s.logger.Debug("history requested", "namespace", req.GetNamespace(), "lock", req.GetLockName(), "remote", addr)
+	filter := history.Filter{Namespace: types.Namespace(req.GetNamespace()), Name: req.GetLockName()}
+	if req.GetSince() != nil {
+		filter.Since = req.GetSince().AsTime()
+	}
+	if req.GetUntil() != nil {
+		filter.Until = req.GetUntil().AsTime()
+	}
+	resp := &pb.HistoryResponse{Events: make([]*pb.HistoryEvent, 0)}
+	for _, e := range s.manager.History(filter) {
+		if !s.visible(ctx, e.Namespace, e.Name) {
+			continue
+		}
+		resp.Events = append(resp.Events, historyEvent(e))
+	}
+	return resp, nil
+}
+
+// Watch streams lock events as they happen until the client cancels the call or the server shuts down. Events of
+// locks the caller may not list are skipped.
+func (s *LockServer) Watch(req *pb.WatchRequest, stream pb.LockService_WatchServer) error {
+	if s.draining.Load() {
+		return status.Error(codes.Unavailable, types.ErrShuttingDown.Error())
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	filter := history.Filter{Name: req.GetLockName(), Prefix: req.GetPrefix()}
+	if !req.GetAllNamespaces() {
+		filter.Namespace = types.Namespace(req.GetNamespace())
+	}
+	s.logger.Debug("watch started", "namespace", filter.Namespace, "lock", filter.Name, "prefix", filter.Prefix, "remote", extractRemote(ctx))
+	events := s.manager.Watch(ctx, filter)
+	// tell the client the watch is established, events recorded from now on are streamed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-s.shutdown:
+			return status.Error(codes.Unavailable, types.ErrShuttingDown.Error())
+		case e, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return status.FromContextError(ctx.Err()).Err()
+				}
+				return status.Error(codes.Aborted, types.ErrWatchLagged.Error())
+			}
+			if !s.visible(ctx, e.Namespace, e.Name) {
+				continue
+			}
+			if err := stream.Send(historyEvent(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// historyEvent converts a recorded lock event to its protobuf message.
+func historyEvent(e history.Event) *pb.HistoryEvent {
+	return &pb.HistoryEvent{
+		Time:      timestamppb.New(e.Time),
+		Type:      string(e.Type),
+		LockName:  e.Name,
+		Pid:       e.Pid,
+		Addr:      e.Addr,
+		Duration:  durationpb.New(e.Duration),
+		Namespace: e.Namespace,
+	}
+}
+
+// Stats returns contention statistics of the locks of a namespace or of all namespaces and their totals
+func (s *LockServer) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	namespace := types.Namespace(req.GetNamespace())
+	s.logger.Debug("stats requested", "namespace", namespace, "all_namespaces", req.GetAllNamespaces(), "remote", extractRemote(ctx))
+	locks, totals, since := s.manager.Stats(func(ns, name string) bool {
+		return (req.GetAllNamespaces() || ns == namespace) && s.visible(ctx, ns, name)
+	})
+	resp := &pb.StatsResponse{
+		Locks:  make([]*pb.LockStats, 0, len(locks)),
+		Totals: lockStats(totals),
+		Since:  timestamppb.New(since),
+	}
+	for _, l := range locks {
+		resp.Locks = append(resp.Locks, lockStats(l))
+	}
+	return resp, nil
+}
+
+// lockStats converts the statistics of a lock to its protobuf message.
+func lockStats(l stats.Lock) *pb.LockStats {
+	return &pb.LockStats{
+		Namespace:      l.Namespace,
+		LockName:       l.Name,
+		Acquisitions:   l.Acquisitions,
+		Timeouts:       l.Timeouts,
+		Cancels:        l.Cancels,
+		Releases:       l.Releases,
+		ForcedReleases: l.ForcedReleases,
+		MaxQueue:       int32(l.MaxQueue),
+		Wait:           durationStats(l.Wait),
+		Hold:           durationStats(l.Hold),
+	}
+}
+
+// durationStats converts a summary of durations to its protobuf message.
+func durationStats(d stats.Durations) *pb.DurationStats {
+	return &pb.DurationStats{
+		Count: d.Count,
+		Avg:   durationpb.New(d.Avg),
+		P50:   durationpb.New(d.P50),
+		P90:   durationpb.New(d.P90),
+		P99:   durationpb.New(d.P99),
+		Max:   durationpb.New(d.Max),
+	}
+}
@@ -0,0 +1,127 @@
+package lockutil
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/sascha-andres/lockutil/internal/lockserver"
+)
+
+// DurationStats summarizes wait or hold durations of a lock.
+type DurationStats struct {
+
+	// Count is the number of recorded durations.
+	Count int64
+
+	// Avg is the average of all recorded durations.
+	Avg time.Duration
+
+	// P50, P90 and P99 are percentiles of the most recent durations.
+	P50, P90, P99 time.Duration
+
+	// Max is the longest recorded duration.
+	Max time.Duration
+}
+
+// LockStats holds the contention statistics of a lock or, for totals, of all returned locks.
+type LockStats struct {
+
+	// Namespace is the namespace of the lock, empty for totals.
+	Namespace string
+
+	// Name is the name of the lock, empty for totals.
+	Name string
+
+	// Acquisitions counts the times the lock was acquired.
+	Acquisitions int64
+
+	// Timeouts counts the requests whose timeout elapsed while waiting.
+	Timeouts int64
+
+	// Cancels counts the requests cancelled by the client while waiting.
+	Cancels int64
+
+	// Releases counts the releases by the holder.
+	Releases int64
+
+	// ForcedReleases counts the releases using a force token.
+	ForcedReleases int64
+
+	// MaxQueue is the largest number of requests waiting for the lock at the same time.
+	MaxQueue int
+
+	// Wait summarizes how long acquisitions waited for the lock.
+	Wait DurationStats
+
+	// Hold summarizes how long the lock was held until released.
+	Hold DurationStats
+}
+
+// Stats are the contention statistics collected by the serving lockd node.
+type Stats struct {
+
+	// Since is the point in time the node started collecting.
+	Since time.Time
+
+	// Locks holds the statistics per lock, sorted by namespace and name.
+	Locks []LockStats
+
+	// Totals sums up the statistics of Locks.
+	Totals LockStats
+}
+
+// Stats retrieves the contention statistics of the locks of the namespace of the client. In clustered mode each
+// node collects the statistics of the requests it handles.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	return c.stats(ctx, &pb.StatsRequest{Namespace: c.namespace})
+}
+
+// StatsAllNamespaces retrieves the contention statistics of the locks of all namespaces, see Stats.
+func (c *Client) StatsAllNamespaces(ctx context.Context) (*Stats, error) {
+	return c.stats(ctx, &pb.StatsRequest{AllNamespaces: true})
+}
+
+// stats retrieves the statistics selected by the request.
+func (c *Client) stats(ctx context.Context, req *pb.StatsRequest) (*Stats, error) {
+	resp, err := c.client.Stats(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stats{
+		Since:  resp.GetSince().AsTime(),
+		Locks:  make([]LockStats, 0, len(resp.GetLocks())),
+		Totals: lockStats(resp.GetTotals()),
+	}
+	for _, l := range resp.GetLocks() {
+		s.Locks = append(s.Locks, lockStats(l))
+	}
+	return s, nil
+}
+
+// lockStats converts the received statistics of a lock.
+func lockStats(l *pb.LockStats) LockStats {
+	return LockStats{
+		Namespace:      l.GetNamespace(),
+		Name:           l.GetLockName(),
+		Acquisitions:   l.GetAcquisitions(),
+		Timeouts:       l.GetTimeouts(),
+		Cancels:        l.GetCancels(),
+		Releases:       l.GetReleases(),
+		ForcedReleases: l.GetForcedReleases(),
+		MaxQueue:       int(l.GetMaxQueue()),
+		Wait:           durationStats(l.GetWait()),
+		Hold:           durationStats(l.GetHold()),
+	}
+}
+
+// durationStats converts a received summary of durations.
+func durationStats(d *pb.DurationStats) DurationStats {
+	return DurationStats{
+		Count: d.GetCount(),
+		Avg:   d.GetAvg().AsDuration(),
+		P50:   d.GetP50().AsDuration(),
+		P90:   d.GetP90().AsDuration(),
+		P99:   d.GetP99().AsDuration(),
+		Max:   d.GetMax().AsDuration(),
+	}
+}